@@ -0,0 +1,54 @@
+package simplerpc
+
+import "sync"
+
+// Capacities of the pooled buffers. Buffers larger than the largest class are
+// not pooled, so an occasional large request does not keep its memory.
+var bufferClasses = [...]int{256, 1024, 4096, 16384, 65536}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// Byte buffer taken from the buffer pool. B can be appended to freely, the
+// grown slice is pooled when the buffer is put back.
+type Buffer struct {
+	B []byte
+}
+
+// Get a buffer with zero length and a capacity of at least size from the pool.
+// Put it back with PutBuffer once it is no longer used.
+func GetBuffer(size int) *Buffer {
+	// find the smallest class the size fits in
+	for i, classSize := range bufferClasses {
+		if size > classSize {
+			continue
+		}
+		if buf, ok := bufferPools[i].Get().(*Buffer); ok {
+			return buf
+		}
+		return &Buffer{
+			B: make([]byte, 0, classSize),
+		}
+	}
+
+	// too large to pool
+	return &Buffer{
+		B: make([]byte, 0, size),
+	}
+}
+
+// Put a buffer back to the pool. Neither the buffer nor the slices taken from
+// it may be used afterwards.
+func PutBuffer(buf *Buffer) {
+	// find the largest class the capacity is enough for
+	c := cap(buf.B)
+	if c > bufferClasses[len(bufferClasses)-1] {
+		return
+	}
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if c >= bufferClasses[i] {
+			buf.B = buf.B[:0]
+			bufferPools[i].Put(buf)
+			return
+		}
+	}
+}
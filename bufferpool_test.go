@@ -0,0 +1,51 @@
+package simplerpc
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferPool(t *testing.T) {
+	// the capacity is at least the requested size
+	for _, size := range []int{0, 1, 256, 257, 65536, 65537} {
+		buf := GetBuffer(size)
+		assert.Equal(t, 0, len(buf.B))
+		assert.GreaterOrEqual(t, cap(buf.B), size)
+		PutBuffer(buf)
+	}
+
+	// a grown buffer is put back with its new capacity and given out empty
+	buf := GetBuffer(10)
+	buf.B = append(buf.B, make([]byte, 2000)...)
+	PutBuffer(buf)
+	for i := 0; i < 10; i++ {
+		buf = GetBuffer(1024)
+		assert.Equal(t, 0, len(buf.B))
+		assert.GreaterOrEqual(t, cap(buf.B), 1024)
+		defer PutBuffer(buf)
+	}
+
+	// buffers smaller than the smallest class or larger than the largest one
+	// are dropped
+	PutBuffer(&Buffer{B: make([]byte, 10)})
+	PutBuffer(&Buffer{B: make([]byte, 100000)})
+}
+
+func BenchmarkGetPutBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := GetBuffer(100)
+		buf.B = append(buf.B, 1, 2, 3)
+		PutBuffer(buf)
+	}
+}
+
+func BenchmarkWriteFrame(b *testing.B) {
+	payload := make([]byte, 100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		writeFrame(io.Discard, payload)
+	}
+}
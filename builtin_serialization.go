@@ -1,5 +1,11 @@
 package simplerpc
 
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
 const (
 	integer_sermode_00   = 0x00
 	integer_sermode_01   = 0x20
@@ -19,7 +25,17 @@ func SerializeInteger(buf []byte, v int64) []byte {
 	} else {
 		uv = uint64(v)
 	}
+	return serializeIntegerImpl(buf, signmask, uv)
+}
+
+// Serialize an unsigned integer to the end of buf and return the new buffer. The
+// format is the same as of non-negative integers, but the full 64-bit range is
+// allowed.
+func SerializeUint64(buf []byte, v uint64) []byte {
+	return serializeIntegerImpl(buf, 0, v)
+}
 
+func serializeIntegerImpl(buf []byte, signmask byte, uv uint64) []byte {
 	// check if fits in mode 00
 	if uv < 0x20 {
 		b := signmask | byte(uv) | integer_sermode_00
@@ -71,7 +87,11 @@ func SerializeInteger(buf []byte, v int64) []byte {
 	return append(buf, tmpbuf[st:]...)
 }
 
-func deserializeIntegerImplNoSign(buf []byte) ([]byte, uint64) {
+func decodeIntegerNoSign(buf []byte, allow64bits bool) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, ErrTruncated
+	}
+
 	// find mode
 	b0 := buf[0]
 	mode := b0 & integer_sermode_mask
@@ -79,25 +99,25 @@ func deserializeIntegerImplNoSign(buf []byte) ([]byte, uint64) {
 
 	// mode 00
 	if mode == integer_sermode_00 {
-		return buf[1:], uint64(b0)
+		return uint64(b0), 1, nil
 	}
 
 	// mode 01
 	if mode == integer_sermode_01 {
 		if len(buf) < 2 {
-			return nil, 0
+			return 0, 0, ErrTruncated
 		}
 		ret := uint64(b0)*256 + uint64(buf[1])
-		return buf[2:], ret
+		return ret, 2, nil
 	}
 
 	// mode 10
 	if mode == integer_sermode_10 {
 		if len(buf) < 3 {
-			return nil, 0
+			return 0, 0, ErrTruncated
 		}
 		ret := (uint64(b0)*256+uint64(buf[1]))*256 + uint64(buf[2])
-		return buf[3:], ret
+		return ret, 3, nil
 	}
 
 	// mode 11
@@ -105,16 +125,17 @@ func deserializeIntegerImplNoSign(buf []byte) ([]byte, uint64) {
 	size := int((b0&0x1c)>>2) + 1
 	buf = buf[1:]
 	if len(buf) < size {
-		return nil, 0
+		return 0, 0, ErrTruncated
 	}
 
 	// start value
 	v := uint64(b0 & 0x3)
 
-	// if size is 8, the 2 bits in the first byte and the first bit
-	// of the next byte must be 0 to fit into the 63-bit value
-	if size == 8 && (v != 0 || buf[0]&0x80 != 0) {
-		return nil, 0
+	// if size is 8, the 2 bits in the first byte must be 0 to fit into
+	// the 64-bit value, and the first bit of the next byte must be 0 too
+	// to fit into the 63-bit value
+	if size == 8 && (v != 0 || (!allow64bits && buf[0]&0x80 != 0)) {
+		return 0, 0, ErrOverflow
 	}
 
 	// combine all bytes of the value
@@ -123,35 +144,128 @@ func deserializeIntegerImplNoSign(buf []byte) ([]byte, uint64) {
 	}
 
 	// return result
-	return buf[size:], v
+	return v, size + 1, nil
+}
+
+func decodeInteger(buf []byte) (int64, int, error) {
+	// deserialize as positive
+	uret, n, err := decodeIntegerNoSign(buf, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// apply negative flag
+	if buf[0]&0x80 == 0x80 {
+		return -int64(uret) - 1, n, nil
+	}
+	return int64(uret), n, nil
+}
+
+func decodeUint64(buf []byte) (uint64, int, error) {
+	if len(buf) > 0 && buf[0]&0x80 != 0 {
+		return 0, 0, ErrOverflow
+	}
+	return decodeIntegerNoSign(buf, true)
+}
+
+func decodeIntegerStrict(buf []byte) (int64, int, error) {
+	// the value must serialize to the same bytes
+	v, n, err := decodeInteger(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	var tmpbuf [9]byte
+	if !bytes.Equal(SerializeInteger(tmpbuf[:0], v), buf[:n]) {
+		return 0, 0, ErrNonCanonical
+	}
+	return v, n, nil
+}
+
+func decodeUint64Strict(buf []byte) (uint64, int, error) {
+	// the value must serialize to the same bytes
+	v, n, err := decodeUint64(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	var tmpbuf [9]byte
+	if !bytes.Equal(SerializeUint64(tmpbuf[:0], v), buf[:n]) {
+		return 0, 0, ErrNonCanonical
+	}
+	return v, n, nil
+}
+
+func decodeBlob(buf []byte) ([]byte, int, error) {
+	return decodeBlobImpl(buf, decodeInteger)
+}
+
+func decodeBlobImpl(buf []byte, decodeSize func([]byte) (int64, int, error)) ([]byte, int, error) {
+	// read size and check if we have enough bytes
+	size, n, err := decodeSize(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size < 0 {
+		return nil, 0, ErrNegativeLength
+	}
+	if size > int64(len(buf)-n) {
+		return nil, 0, ErrTruncated
+	}
+
+	// return the payload
+	end := n + int(size)
+	return buf[n:end:end], end, nil
+}
+
+func decodeBool(buf []byte) (bool, int, error) {
+	if len(buf) == 0 {
+		return false, 0, ErrTruncated
+	}
+	if buf[0] > 1 {
+		return false, 0, ErrInvalidValue
+	}
+	return buf[0] == 1, 1, nil
 }
 
 // Deserialize an integer from the given buf and return the remaining bytes and
 // the deserialized value. In case of an error (format error or nil input buffer),
 // nil is returned
 func DeserializeInteger(buf []byte) ([]byte, int64) {
-	if len(buf) == 0 {
+	v, n, err := decodeInteger(buf)
+	if err != nil {
 		return nil, 0
 	}
+	return buf[n:], v
+}
 
-	// get negative flag
-	negative := buf[0]&0x80 == 0x80
+// Deserialize an unsigned integer from the given buf and return the remaining
+// bytes and the deserialized value. In case of an error (format error, negative
+// value or nil input buffer), nil is returned
+func DeserializeUint64(buf []byte) ([]byte, uint64) {
+	v, n, err := decodeUint64(buf)
+	if err != nil {
+		return nil, 0
+	}
+	return buf[n:], v
+}
 
-	// deserialize as positive
-	newbuf, uret := deserializeIntegerImplNoSign(buf)
-	if newbuf == nil {
+// Deserialize an integer like DeserializeInteger, but also fail if the value is
+// not in its canonical form, i.e. not the way SerializeInteger writes it
+func DeserializeIntegerStrict(buf []byte) ([]byte, int64) {
+	v, n, err := decodeIntegerStrict(buf)
+	if err != nil {
 		return nil, 0
 	}
-	var ret int64
-	if negative {
-		ret = int64(uret)
-		ret = -ret
-		ret--
-		//		ret = -int64(uret) - 1
-	} else {
-		ret = int64(uret)
+	return buf[n:], v
+}
+
+// Deserialize an unsigned integer like DeserializeUint64, but also fail if the
+// value is not in its canonical form, i.e. not the way SerializeUint64 writes it
+func DeserializeUint64Strict(buf []byte) ([]byte, uint64) {
+	v, n, err := decodeUint64Strict(buf)
+	if err != nil {
+		return nil, 0
 	}
-	return newbuf, ret
+	return buf[n:], v
 }
 
 // Serialize a byte slice to the end of buf and return the new buffer
@@ -168,13 +282,11 @@ func SerializeBlob(buf []byte, data []byte) []byte {
 // the deserialized value. In case of an error (format error or nil input buffer),
 // nil is returned
 func DeserializeBlob(buf []byte) (newbuf []byte, blobdata []byte) {
-	var size int64
-	buf, size = DeserializeInteger(buf)
-	if buf == nil || size > int64(len(buf)) {
+	blobdata, n, err := decodeBlob(buf)
+	if err != nil {
 		return nil, nil
 	}
-	blobdata = buf[:size]
-	newbuf = buf[size:]
+	newbuf = buf[n:]
 	return
 }
 
@@ -196,3 +308,56 @@ func DeserializeString(_buf []byte) (buf []byte, ret string) {
 	ret = string(data)
 	return
 }
+
+// Serialize a boolean to the end of buf and return the new buffer
+func SerializeBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+// Deserialize a boolean from the given buf and return the remaining bytes and
+// the deserialized value. In case of an error (value other than 0 or 1 or nil
+// input buffer), nil is returned
+func DeserializeBool(buf []byte) ([]byte, bool) {
+	v, n, err := decodeBool(buf)
+	if err != nil {
+		return nil, false
+	}
+	return buf[n:], v
+}
+
+// Serialize a 64-bit floating point number to the end of buf and return the new
+// buffer. The value is written as its 8-byte IEEE-754 representation in
+// big-endian byte order.
+func SerializeFloat64(buf []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+// Deserialize a 64-bit floating point number from the given buf and return the
+// remaining bytes and the deserialized value. In case of an error (not enough
+// bytes or nil input buffer), nil is returned
+func DeserializeFloat64(buf []byte) ([]byte, float64) {
+	if len(buf) < 8 {
+		return nil, 0
+	}
+	return buf[8:], math.Float64frombits(binary.BigEndian.Uint64(buf))
+}
+
+// Serialize a 32-bit floating point number to the end of buf and return the new
+// buffer. The value is written as its 4-byte IEEE-754 representation in
+// big-endian byte order.
+func SerializeFloat32(buf []byte, v float32) []byte {
+	return binary.BigEndian.AppendUint32(buf, math.Float32bits(v))
+}
+
+// Deserialize a 32-bit floating point number from the given buf and return the
+// remaining bytes and the deserialized value. In case of an error (not enough
+// bytes or nil input buffer), nil is returned
+func DeserializeFloat32(buf []byte) ([]byte, float32) {
+	if len(buf) < 4 {
+		return nil, 0
+	}
+	return buf[4:], math.Float32frombits(binary.BigEndian.Uint32(buf))
+}
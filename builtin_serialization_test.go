@@ -1,7 +1,9 @@
 package simplerpc
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
 
@@ -180,4 +182,255 @@ func TestDeserializeString(t *testing.T) {
 	// invalid: not that many bytes as the given length
 	newbuf, _ = DeserializeString([]byte{0x3, 'a', 'b'})
 	assert.Nil(t, newbuf)
+
+	// invalid: negative length
+	newbuf, _ = DeserializeString([]byte{0x80, 'a'})
+	assert.Nil(t, newbuf)
+}
+
+func TestDeserializeIntegerStrict(t *testing.T) {
+	// canonical values are accepted
+	for _, v := range []int64{0, -1, 0x1f, -0x20, 0x20, 0x1fff, 0x2000, 0x1fffff, 0x200000, math.MaxInt64, math.MinInt64} {
+		buf := SerializeInteger([]byte{}, v)
+		newbuf, v2 := DeserializeIntegerStrict(append(buf, 9))
+		assert.Equal(t, []byte{9}, newbuf)
+		assert.Equal(t, v, v2)
+	}
+
+	// non-canonical values are rejected
+	nonCanonical := [][]byte{
+		{0x20, 0x01},             // 1 in mode 01
+		{0xa0, 0x00},             // -1 in mode 01
+		{0x40, 0x00, 0x01},       // 1 in mode 10
+		{0x60, 0x01},             // 1 in mode 11
+		{0x60, 0xff},             // 0xff in mode 11 instead of mode 01
+		{0x64, 0x00, 0x00},       // 0 in mode 11 with 2 bytes
+		{0x64, 0x30, 0x00},       // 0x3000 in mode 11 instead of mode 10
+		{0x68, 0x00, 0x40, 0x00}, // 0x4000 in mode 11 with a leading zero byte
+	}
+	for _, buf := range nonCanonical {
+		newbuf, _ := DeserializeInteger(buf)
+		assert.NotNil(t, newbuf, "for %x", buf)
+		newbuf, _ = DeserializeIntegerStrict(buf)
+		assert.Nil(t, newbuf, "for %x", buf)
+	}
+
+	// unsigned integers
+	newbuf, v := DeserializeUint64Strict([]byte{0x7c, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Equal(t, []byte{}, newbuf)
+	assert.Equal(t, uint64(math.MaxUint64), v)
+	newbuf, _ = DeserializeUint64Strict([]byte{0x20, 0x01})
+	assert.Nil(t, newbuf)
+
+	// other errors
+	newbuf, _ = DeserializeIntegerStrict(nil)
+	assert.Nil(t, newbuf)
+}
+
+func TestSerializeUint64(t *testing.T) {
+	test1 := func(v uint64) []byte {
+		return SerializeUint64([]byte{}, v)
+	}
+
+	// same as integers in the 63-bit range
+	assert.Equal(t, []byte{0x1f}, test1(0x1f))
+	assert.Equal(t, []byte{0x3f, 0xff}, test1(0x1fff))
+	assert.Equal(t, []byte{0x7c, 0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef}, test1(0x1234567890abcdef))
+
+	// above 63 bits
+	assert.Equal(t, []byte{0x7c, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, test1(0x8000000000000000))
+	assert.Equal(t, []byte{0x7c, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, test1(math.MaxUint64))
+}
+
+func TestDeserializeUint64(t *testing.T) {
+	test1 := func(bytes ...byte) uint64 {
+		newbuf, ret := DeserializeUint64(append(bytes, 0))
+		l := len(newbuf)
+		if l != 1 {
+			panic(fmt.Sprintf("failed to deserialize unsigned integer, l=%d", l))
+		}
+		return ret
+	}
+
+	assert.EqualValues(t, 0x1f, test1(0x1f))
+	assert.EqualValues(t, 0x1edc, test1(0x3e, 0xdc))
+	assert.EqualValues(t, 0x7890abcdef123456, test1(0x7c, 0x78, 0x90, 0xab, 0xcd, 0xef, 0x12, 0x34, 0x56))
+	assert.EqualValues(t, uint64(0x8000000000000000), test1(0x7c, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00))
+	assert.EqualValues(t, uint64(math.MaxUint64), test1(0x7c, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff))
+
+	// invalid: empty buffer
+	newbuf, _ := DeserializeUint64(nil)
+	assert.Nil(t, newbuf)
+
+	// invalid: negative
+	newbuf, _ = DeserializeUint64([]byte{0x80})
+	assert.Nil(t, newbuf)
+
+	// invalid: more than 64 bits
+	newbuf, _ = DeserializeUint64([]byte{0x7d, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	assert.Nil(t, newbuf)
+
+	// integers still reject values above 63 bits
+	newbuf, _ = DeserializeInteger([]byte{0x7c, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	assert.Nil(t, newbuf)
+}
+
+func TestUint64SerializationWithRandomNumbers(t *testing.T) {
+	var arr [12]byte
+	for i := 0; i < 100000; i++ {
+		n := rand.Uint64()
+		buf := SerializeUint64(arr[:0], n)
+		nb, newn := DeserializeUint64(buf)
+		assert.Equal(t, []byte{}, nb, "for ", n)
+		assert.Equal(t, n, newn)
+	}
+}
+
+func TestBoolSerialization(t *testing.T) {
+	// serialize
+	assert.Equal(t, []byte{0x00}, SerializeBool([]byte{}, false))
+	assert.Equal(t, []byte{0x01}, SerializeBool([]byte{}, true))
+
+	// deserialize
+	newbuf, v := DeserializeBool([]byte{0x01, 0x05})
+	assert.Equal(t, []byte{0x05}, newbuf)
+	assert.True(t, v)
+	newbuf, v = DeserializeBool([]byte{0x00})
+	assert.Equal(t, []byte{}, newbuf)
+	assert.False(t, v)
+
+	// invalid: empty buffer
+	newbuf, _ = DeserializeBool(nil)
+	assert.Nil(t, newbuf)
+
+	// invalid: value other than 0 or 1
+	newbuf, _ = DeserializeBool([]byte{0x02})
+	assert.Nil(t, newbuf)
+}
+
+func TestFloat64Serialization(t *testing.T) {
+	// serialize
+	assert.Equal(t, []byte{0x3f, 0xf0, 0, 0, 0, 0, 0, 0}, SerializeFloat64([]byte{}, 1.0))
+	assert.Equal(t, []byte{0xc0, 0x09, 0x21, 0xfb, 0x54, 0x44, 0x2d, 0x18}, SerializeFloat64([]byte{}, -math.Pi))
+
+	// round-trip
+	for _, f := range []float64{0, -0.0, 1.5, -1e300, math.SmallestNonzeroFloat64, math.Inf(1), math.Inf(-1)} {
+		newbuf, v := DeserializeFloat64(SerializeFloat64([]byte{}, f))
+		assert.Equal(t, []byte{}, newbuf)
+		assert.Equal(t, math.Float64bits(f), math.Float64bits(v))
+	}
+	_, v := DeserializeFloat64(SerializeFloat64([]byte{}, math.NaN()))
+	assert.True(t, math.IsNaN(v))
+
+	// invalid: not enough bytes
+	newbuf, _ := DeserializeFloat64([]byte{0x3f, 0xf0, 0, 0, 0, 0, 0})
+	assert.Nil(t, newbuf)
+}
+
+func TestFloat32Serialization(t *testing.T) {
+	// serialize
+	assert.Equal(t, []byte{0x3f, 0x80, 0, 0}, SerializeFloat32([]byte{}, 1.0))
+	assert.Equal(t, []byte{0xc0, 0x49, 0x0f, 0xdb}, SerializeFloat32([]byte{}, -math.Pi))
+
+	// round-trip
+	for _, f := range []float32{0, 1.5, -1e30, math.SmallestNonzeroFloat32, float32(math.Inf(1))} {
+		newbuf, v := DeserializeFloat32(append(SerializeFloat32([]byte{}, f), 7))
+		assert.Equal(t, []byte{7}, newbuf)
+		assert.Equal(t, f, v)
+	}
+
+	// invalid: not enough bytes
+	newbuf, _ := DeserializeFloat32([]byte{0x3f, 0x80, 0})
+	assert.Nil(t, newbuf)
+}
+
+func FuzzDeserializeInteger(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x9f})
+	f.Add([]byte{0x3f, 0xff})
+	f.Add([]byte{0x60, 0x01})
+	f.Add([]byte{0x7c, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// the remaining bytes must be a suffix of the input
+		newbuf, v := DeserializeInteger(data)
+		if newbuf == nil {
+			return
+		}
+		n := len(data) - len(newbuf)
+		assert.Equal(t, data[n:], newbuf)
+		assert.Equal(t, serializedIntegerSize(data[0]), n)
+
+		// the value is re-serialized in its shortest form, which deserializes
+		// to the same value and serializes to the same bytes again
+		canonical := SerializeInteger([]byte{}, v)
+		assert.LessOrEqual(t, len(canonical), n)
+		rest, v2 := DeserializeInteger(canonical)
+		assert.Equal(t, []byte{}, rest)
+		assert.Equal(t, v, v2)
+		assert.Equal(t, canonical, SerializeInteger([]byte{}, v2))
+
+		// strict mode accepts the canonical form only
+		strictbuf, _ := DeserializeIntegerStrict(data)
+		assert.Equal(t, bytes.Equal(canonical, data[:n]), strictbuf != nil)
+	})
+}
+
+func FuzzIntegerRoundTrip(f *testing.F) {
+	f.Add(int64(0))
+	f.Add(int64(-1))
+	f.Add(int64(math.MaxInt64))
+	f.Add(int64(math.MinInt64))
+	f.Fuzz(func(t *testing.T, v int64) {
+		// the whole serialized value is consumed and gives back the value
+		buf := SerializeInteger([]byte{}, v)
+		assert.Equal(t, serializedIntegerSize(buf[0]), len(buf))
+		rest, v2 := DeserializeInteger(buf)
+		assert.Equal(t, []byte{}, rest)
+		assert.Equal(t, v, v2)
+	})
+}
+
+func FuzzDeserializeBlob(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x02, 'a', 'b', 'c'})
+	f.Add([]byte{0x80, 'a'})
+	f.Add([]byte{0x20, 0x03, 'a'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// the payload must be the bytes before the remaining ones
+		newbuf, blob := DeserializeBlob(data)
+		if newbuf == nil {
+			return
+		}
+		n := len(data) - len(newbuf)
+		assert.Equal(t, data[n-len(blob):n], blob)
+
+		// re-serializing gives back the same blob
+		canonical := SerializeBlob([]byte{}, blob)
+		assert.LessOrEqual(t, len(canonical), n)
+		rest, blob2 := DeserializeBlob(canonical)
+		assert.Equal(t, []byte{}, rest)
+		assert.Equal(t, blob, blob2)
+	})
+}
+
+func FuzzDeserializeString(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x03, 'H', 'i', '!'})
+	f.Add([]byte{0x80})
+	f.Add([]byte{0x05, 'a'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// must agree with the blob deserializer
+		newbuf, s := DeserializeString(data)
+		blobbuf, blob := DeserializeBlob(data)
+		assert.Equal(t, blobbuf, newbuf)
+		if newbuf == nil {
+			return
+		}
+		assert.Equal(t, string(blob), s)
+
+		// re-serializing gives back the same string
+		rest, s2 := DeserializeString(SerializeString([]byte{}, s))
+		assert.Equal(t, []byte{}, rest)
+		assert.Equal(t, s, s2)
+	})
 }
@@ -0,0 +1,189 @@
+package simplerpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Default number of request ids remembered by a canceller
+const defaultCancelWindow = 1024
+
+// Result of the cancel function of the server
+const (
+	// the request was not cancelled: it has already finished, or the
+	// canceller does not remember request ids
+	CancelResultUnknown int64 = 0
+
+	// the request was running and it got cancelled
+	CancelResultFound int64 = 1
+
+	// the request has not arrived yet, it will be rejected when it arrives
+	CancelResultPending int64 = 2
+)
+
+// Set of the most recent request ids, forgetting the oldest one when full
+type idWindow struct {
+	ring      []int64
+	positions map[int64]int
+	next      int
+}
+
+func newIdWindow(size int) idWindow {
+	return idWindow{
+		ring:      make([]int64, 0, size),
+		positions: make(map[int64]int, size),
+	}
+}
+
+// Add an id as the newest one. An id already present moves to the newest
+// position, its old slot is skipped when it is reached.
+func (w *idWindow) add(id int64) {
+	// no room at all
+	if cap(w.ring) == 0 {
+		return
+	}
+
+	// append while not full
+	if len(w.ring) < cap(w.ring) {
+		w.positions[id] = len(w.ring)
+		w.ring = append(w.ring, id)
+		return
+	}
+
+	// forget the oldest one, unless it was added again since
+	oldest := w.ring[w.next]
+	if w.positions[oldest] == w.next {
+		delete(w.positions, oldest)
+	}
+	w.ring[w.next] = id
+	w.positions[id] = w.next
+	w.next = (w.next + 1) % len(w.ring)
+}
+
+func (w *idWindow) contains(id int64) bool {
+	_, found := w.positions[id]
+	return found
+}
+
+func (w *idWindow) remove(id int64) bool {
+	_, found := w.positions[id]
+	delete(w.positions, id)
+	return found
+}
+
+type cancelEntry struct {
+	cancel    context.CancelFunc
+	serviceId int64
+}
+
+type canceller struct {
+	mu       sync.Mutex
+	cancels  map[int64]cancelEntry
+	closed   bool
+	finished idWindow
+	pending  idWindow
+}
+
+func newCanceller(window int) *canceller {
+	return &canceller{
+		cancels:  map[int64]cancelEntry{},
+		finished: newIdWindow(window),
+		pending:  newIdWindow(window),
+	}
+}
+
+func (c *canceller) addRequest(ctx context.Context, requestId, serviceId int64) (context.Context, bool) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// if closed or the request was cancelled before it arrived, reject it
+	if c.closed || c.pending.remove(requestId) {
+		return ctx, false
+	}
+
+	// create context with cancellation
+	ctx, cancel := context.WithCancel(ctx)
+
+	// add cancellation
+	c.cancels[requestId] = cancelEntry{
+		cancel:    cancel,
+		serviceId: serviceId,
+	}
+
+	// done
+	return ctx, true
+}
+
+func (c *canceller) requestFinished(requestId int64) (cancelled bool) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// find cancel
+	entry, found := c.cancels[requestId]
+
+	// if found, delete it and release the context
+	if found {
+		delete(c.cancels, requestId)
+		entry.cancel()
+	}
+
+	// remember that it finished
+	c.finished.add(requestId)
+
+	// return cancelled if not found
+	return !found
+}
+
+func (c *canceller) cancelRequest(requestId int64) int64 {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// find cancel
+	entry, found := c.cancels[requestId]
+
+	// if found, delete it and cancel
+	if found {
+		delete(c.cancels, requestId)
+		entry.cancel()
+		return CancelResultFound
+	}
+
+	// if finished recently, there is nothing to do
+	if c.finished.contains(requestId) || cap(c.pending.ring) == 0 {
+		return CancelResultUnknown
+	}
+
+	// not arrived yet, remember it
+	c.pending.add(requestId)
+	return CancelResultPending
+}
+
+func (c *canceller) close() {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// cancel every request, and the ones arriving later too
+	c.closed = true
+	for requestId, entry := range c.cancels {
+		delete(c.cancels, requestId)
+		entry.cancel()
+	}
+}
+
+func (c *canceller) cancelService(serviceId int64) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// cancel every request of the service
+	for requestId, entry := range c.cancels {
+		if entry.serviceId == serviceId {
+			delete(c.cancels, requestId)
+			entry.cancel()
+		}
+	}
+}
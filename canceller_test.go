@@ -0,0 +1,173 @@
+package simplerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdWindow(t *testing.T) {
+	// add ids to a window of 3
+	w := newIdWindow(3)
+	w.add(1)
+	w.add(2)
+	w.add(3)
+	assert.True(t, w.contains(1))
+	assert.True(t, w.contains(2))
+	assert.True(t, w.contains(3))
+
+	// adding another one forgets the oldest
+	w.add(4)
+	assert.False(t, w.contains(1))
+	assert.True(t, w.contains(4))
+
+	// removed ids are forgotten
+	assert.True(t, w.remove(2))
+	assert.False(t, w.remove(2))
+	assert.False(t, w.contains(2))
+
+	// an id added again is not forgotten with its old position
+	w.remove(3)
+	w.add(3)
+	w.add(5)
+	assert.True(t, w.contains(3))
+	w.add(6)
+	assert.True(t, w.contains(3))
+	assert.False(t, w.contains(4))
+	w.add(7)
+	assert.False(t, w.contains(3))
+	assert.True(t, w.contains(5))
+
+	// an id still present moves to the newest position when added again, so
+	// it outlives the ids added before it
+	w = newIdWindow(3)
+	w.add(1)
+	w.add(2)
+	w.add(3)
+	w.add(2)
+	w.add(4)
+	w.add(5)
+	assert.True(t, w.contains(2))
+	assert.False(t, w.contains(3))
+	w.add(6)
+	assert.False(t, w.contains(2))
+
+	// empty window remembers nothing
+	w = newIdWindow(0)
+	w.add(1)
+	assert.False(t, w.contains(1))
+}
+
+func TestCancelResult(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+
+	// start a slow call
+	done := startSlowCall(server.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+
+	// cancel it, expecting a response
+	cancel := func(requestId, requestIdToCancel byte) []byte {
+		req := []byte{
+			requestId,         // request id
+			0,                 // service id
+			1,                 // function id: cancel
+			requestIdToCancel, // request id to cancel
+		}
+		return server.ProcessRequest(context.Background(), req, nil)
+	}
+	assert.Equal(t, []byte{
+		10, // request id
+		1,  // success
+		1,  // found
+	}, cancel(10, 1))
+	<-done
+
+	// cancelling it again, it is already finished
+	assert.Equal(t, []byte{
+		11, // request id
+		1,  // success
+		0,  // unknown
+	}, cancel(11, 1))
+
+	// cancel a request not arrived yet
+	assert.Equal(t, []byte{
+		12, // request id
+		1,  // success
+		2,  // pending
+	}, cancel(12, 2))
+
+	// when it arrives, it is rejected right away
+	t0 := time.Now()
+	resp := <-startSlowCall(server.ProcessRequest, 2)
+	assert.Less(t, time.Since(t0), time.Millisecond*100)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 2 was cancelled")), resp)
+
+	// the same id can be used again afterwards
+	req := []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{2, 1, 5}, resp)
+}
+
+func TestCancelWindowDisabled(t *testing.T) {
+	// create server not remembering request ids
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithCancelWindow(0))
+
+	// cancel a request not arrived yet
+	req := []byte{
+		1, // request id
+		0, // service id
+		1, // function id: cancel
+		2, // request id to cancel
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1, // request id
+		1, // success
+		0, // unknown
+	}, resp)
+
+	// the request is not affected
+	req = []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{2, 1, 5}, resp)
+}
+
+func TestCancellerReusedRequestId(t *testing.T) {
+	// run requests 1, 2, then 1 again and 3 with a window of 2
+	c := newCanceller(2)
+	for _, requestId := range []int64{1, 2, 1, 3} {
+		_, ok := c.addRequest(context.Background(), requestId, 1)
+		assert.True(t, ok)
+		c.requestFinished(requestId)
+	}
+
+	// the reused id finished recently, so a late cancel is not remembered as
+	// pending and the next request with the id is not rejected
+	assert.Equal(t, CancelResultUnknown, c.cancelRequest(1))
+	_, ok := c.addRequest(context.Background(), 1, 1)
+	assert.True(t, ok)
+}
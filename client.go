@@ -0,0 +1,238 @@
+package simplerpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Error returned by the client when the connection is closed
+var ErrClientClosed = errors.New("client closed")
+
+// Error returned by the client when the server responded with a failure without
+// telling the reason
+var ErrRequestFailed = errors.New("request failed")
+
+// Error returned by the client when the response cannot be deserialized
+var ErrInvalidResponse = errors.New("invalid response")
+
+type clientResult struct {
+	resp []byte
+	err  error
+}
+
+// Client type for calling functions on a remote server. Calls are multiplexed
+// over a single connection using the same framing as ServeTCP, so a single
+// client can be used from multiple goroutines concurrently.
+type Client struct {
+	conn    io.ReadWriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextId  int64
+	pending map[int64]chan clientResult
+	err     error
+}
+
+// Create a new client on the given connection. The client takes ownership of
+// the connection and closes it when Close is called.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	c := &Client{
+		conn:    conn,
+		pending: map[int64]chan clientResult{},
+	}
+	go c.readResponses()
+	return c
+}
+
+// Connect to the server at the given TCP address and create a client on the
+// connection
+func DialTCP(ctx context.Context, address string) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Close the client and its connection. Pending calls fail with ErrClientClosed.
+func (c *Client) Close() error {
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+func (c *Client) fail(err error) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// keep the first error
+	if c.err == nil {
+		c.err = err
+	}
+
+	// fail all pending calls
+	for requestId, ch := range c.pending {
+		delete(c.pending, requestId)
+		ch <- clientResult{err: c.err}
+	}
+}
+
+func (c *Client) readResponses() {
+	reader := bufio.NewReader(c.conn)
+	for {
+		// read response
+		frame, err := readFrame(reader)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClientClosed
+			}
+			c.fail(err)
+			return
+		}
+
+		// parse headers, ignore malformed responses
+		frame, requestId := DeserializeInteger(frame)
+		frame, status := DeserializeInteger(frame)
+		if frame == nil {
+			continue
+		}
+
+		// decode result
+		var result clientResult
+		switch status {
+		case StatusSuccess:
+			result.resp = frame
+		case StatusError:
+			_, rpcErr := DeserializeError(frame)
+			if rpcErr != nil {
+				result.err = rpcErr
+			} else {
+				result.err = ErrRequestFailed
+			}
+		default:
+			result.err = ErrRequestFailed
+		}
+
+		// find the pending call and deliver the result
+		c.mu.Lock()
+		ch, found := c.pending[requestId]
+		if found {
+			delete(c.pending, requestId)
+			ch <- result
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) allocateRequestId() (int64, error) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// check if the client is still usable
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	// allocate id
+	c.nextId++
+	return c.nextId, nil
+}
+
+func (c *Client) addPending() (int64, chan clientResult, error) {
+	// lock mutex
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// check if the client is still usable
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+
+	// allocate id and add pending slot, buffered so delivering never blocks
+	c.nextId++
+	ch := make(chan clientResult, 1)
+	c.pending[c.nextId] = ch
+	return c.nextId, ch, nil
+}
+
+func (c *Client) removePending(requestId int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, requestId)
+}
+
+func (c *Client) send(requestId, serviceId, functionId, timeout_ms int64, req []byte) error {
+	// serialize request after the space of the frame header, with the timeout
+	// if there is one
+	frame := GetBuffer(frameHeaderSpace + 36 + len(req))
+	defer PutBuffer(frame)
+	buf := SerializeInteger(frame.B[:frameHeaderSpace], requestId)
+	if timeout_ms > 0 {
+		buf = SerializeInteger(buf, -serviceId-1)
+		buf = SerializeInteger(buf, functionId)
+		buf = SerializeInteger(buf, timeout_ms)
+	} else {
+		buf = SerializeInteger(buf, serviceId)
+		buf = SerializeInteger(buf, functionId)
+	}
+	buf = append(buf, req...)
+	frame.B = buf
+
+	// write it
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writeReservedFrame(c.conn, buf)
+}
+
+// Call a function on the server and wait for its response. If the context has a
+// deadline, it is sent to the server as a timeout. On success, the
+// serialized return value is returned. If the server reports a failure, the
+// *Error describing it is returned, or ErrRequestFailed if the server did not
+// tell the reason. If the context is done before the response
+// arrives, a cancel request is sent to the server so the remote function's
+// context is cancelled too, and the context's error is returned.
+func (c *Client) Call(ctx context.Context, serviceId, functionId int64, req []byte) ([]byte, error) {
+	// allocate request id and add pending slot
+	requestId, ch, err := c.addPending()
+	if err != nil {
+		return nil, err
+	}
+
+	// send request, with the time left until the deadline of the context
+	var timeout_ms int64
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout_ms = max(int64((time.Until(deadline)+time.Millisecond-1)/time.Millisecond), 1)
+	}
+	err = c.send(requestId, serviceId, functionId, timeout_ms, req)
+	if err != nil {
+		c.removePending(requestId)
+		return nil, err
+	}
+
+	// wait for the response
+	select {
+	case result := <-ch:
+		return result.resp, result.err
+	case <-ctx.Done():
+		c.removePending(requestId)
+		c.Notify(0, ServerFunctionCancel, SerializeInteger(nil, requestId))
+		return nil, ctx.Err()
+	}
+}
+
+// Call a function on the server without waiting for a response. The request is
+// sent with a negative request id, so the server does not respond to it.
+func (c *Client) Notify(serviceId, functionId int64, req []byte) error {
+	requestId, err := c.allocateRequestId()
+	if err != nil {
+		return err
+	}
+	return c.send(-requestId, serviceId, functionId, 0, req)
+}
@@ -0,0 +1,286 @@
+package simplerpc
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCall(t *testing.T) {
+	// create server and client
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id:    1,
+			value: "asdf",
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// add 2 numbers
+	resp, err := client.Call(context.Background(), 1, id_testfunc_add_nums, []byte{5, 6})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{11}, resp)
+
+	// append string
+	resp, err = client.Call(context.Background(), 1, id_testfunc_append_string, SerializeString([]byte{}, "qw"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{6, 'a', 's', 'd', 'f', 'q', 'w'}, resp)
+
+	// get services from the server
+	resp, err = client.Call(context.Background(), 0, 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 1, 0}, resp)
+
+	// unknown function fails
+	_, err = client.Call(context.Background(), 1, 99, nil)
+	assert.Equal(t, NewError(ErrorCodeHandlerError, "function 99 of service 1 failed"), err)
+
+	// unknown service fails
+	_, err = client.Call(context.Background(), 5, 1, nil)
+	assert.Equal(t, NewError(ErrorCodeUnknownService, "no service with id 5"), err)
+
+	// close the client, calls fail afterwards
+	assert.Nil(t, client.Close())
+	_, err = client.Call(context.Background(), 1, id_testfunc_add_nums, []byte{5, 6})
+	assert.Equal(t, ErrClientClosed, err)
+	assert.Nil(t, stop())
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	// create server and client
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// the slow call must not block the fast one
+	slowDone := make(chan error)
+	go func() {
+		_, err := client.Call(context.Background(), 1, id_testfunc_wait_a_little, nil)
+		slowDone <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+	t0 := time.Now()
+	_, err = client.Call(context.Background(), 0, 2, []byte{0, 1})
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(t0), time.Millisecond*100)
+	assert.Nil(t, <-slowDone)
+
+	// done
+	client.Close()
+	assert.Nil(t, stop())
+}
+
+func TestClientCallContextDone(t *testing.T) {
+	// create server and client
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// the call gives up when the context times out
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	_, err = client.Call(ctx, 1, id_testfunc_wait_a_little, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// done
+	client.Close()
+	assert.Nil(t, stop())
+}
+
+func TestClientNotify(t *testing.T) {
+	// create client on a pipe
+	clientConn, serverConn := net.Pipe()
+	client := NewClient(clientConn)
+	defer client.Close()
+
+	// send notification
+	go client.Notify(3, 4, []byte{5})
+
+	// check the request sent, the request id must be negative
+	frame, err := readFrame(bufio.NewReader(serverConn))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		0x80, // request id=-1
+		3,    // service id
+		4,    // function id
+		5,    // payload
+	}, frame)
+}
+
+func TestClientServerClosed(t *testing.T) {
+	// create client on a pipe
+	clientConn, serverConn := net.Pipe()
+	client := NewClient(clientConn)
+
+	// start a call, then close the other side
+	done := make(chan error)
+	go func() {
+		_, err := client.Call(context.Background(), 1, 1, nil)
+		done <- err
+	}()
+	_, err := readFrame(bufio.NewReader(serverConn))
+	assert.Nil(t, err)
+	serverConn.Close()
+
+	// the pending call fails
+	assert.Equal(t, ErrClientClosed, <-done)
+}
+
+type blockingService struct {
+	cancelled chan struct{}
+}
+
+func (srv *blockingService) GetServiceId() int64 {
+	return 1
+}
+func (srv *blockingService) GetRevision() string {
+	return ""
+}
+func (srv *blockingService) CallFunction(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) []byte {
+	// block until cancelled
+	<-ctx.Done()
+	close(srv.cancelled)
+	return nil
+}
+
+func TestClientCallCancelsRemoteRequest(t *testing.T) {
+	// create server and client
+	service := &blockingService{
+		cancelled: make(chan struct{}),
+	}
+	server, _ := NewServer([]ServerService{service})
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// cancel the call after it started
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+	_, err = client.Call(ctx, 1, 1, nil)
+	assert.Equal(t, context.Canceled, err)
+
+	// the remote handler's context must be cancelled
+	select {
+	case <-service.cancelled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "remote request was not cancelled")
+	}
+
+	// done
+	client.Close()
+	assert.Nil(t, stop())
+}
+
+func TestClientCallSendsCancelRequest(t *testing.T) {
+	// create client on a pipe
+	clientConn, serverConn := net.Pipe()
+	client := NewClient(clientConn)
+	defer client.Close()
+	reader := bufio.NewReader(serverConn)
+
+	// start a call with a cancellable context
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := client.Call(ctx, 5, 6, nil)
+		done <- err
+	}()
+
+	// read the request, then cancel it
+	frame, err := readFrame(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 5, 6}, frame)
+	cancel()
+
+	// the cancel request must be sent without expecting a response
+	frame, err = readFrame(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		0x81, // request id=-2
+		0,    // service id
+		1,    // function id: cancel
+		1,    // request id to cancel
+	}, frame)
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestClientHugeFrameLength(t *testing.T) {
+	// a server answering with a frame declaring 64 GiB, then closing the
+	// connection
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		readFrame(bufio.NewReader(serverConn))
+		serverConn.Write(SerializeInteger([]byte{}, 1<<36))
+		serverConn.Close()
+	}()
+
+	// the client fails instead of allocating the frame
+	client := NewClient(clientConn)
+	defer client.Close()
+	_, err := client.Call(context.Background(), 1, 1, nil)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestClientLegacyFailure(t *testing.T) {
+	// create client on a pipe
+	clientConn, serverConn := net.Pipe()
+	client := NewClient(clientConn)
+	defer client.Close()
+
+	// respond to the call with the legacy failure status
+	go func() {
+		readFrame(bufio.NewReader(serverConn))
+		writeFrame(serverConn, []byte{
+			1, // request id
+			0, // failed
+		})
+	}()
+	_, err := client.Call(context.Background(), 1, 1, nil)
+	assert.Equal(t, ErrRequestFailed, err)
+}
+
+func TestClientCallSendsTimeout(t *testing.T) {
+	// create client on a pipe
+	clientConn, serverConn := net.Pipe()
+	client := NewClient(clientConn)
+	defer client.Close()
+	reader := bufio.NewReader(serverConn)
+
+	// start a call with a deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go client.Call(ctx, 5, 6, []byte{7})
+
+	// the timeout is sent in the header
+	frame, err := readFrame(reader)
+	assert.Nil(t, err)
+	frame, requestId := DeserializeInteger(frame)
+	frame, serviceId := DeserializeInteger(frame)
+	frame, functionId := DeserializeInteger(frame)
+	frame, timeout_ms := DeserializeInteger(frame)
+	assert.EqualValues(t, 1, requestId)
+	assert.EqualValues(t, -6, serviceId)
+	assert.EqualValues(t, 6, functionId)
+	assert.InDelta(t, 1000, timeout_ms, 100)
+	assert.Equal(t, []byte{7}, frame)
+}
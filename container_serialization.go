@@ -0,0 +1,99 @@
+package simplerpc
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Serialize a list to the end of buf and return the new buffer. The length of
+// the list is written first, then each element with the given function.
+func SerializeList[T any](buf []byte, list []T, serialize func([]byte, T) []byte) []byte {
+	buf = SerializeInteger(buf, int64(len(list)))
+	for _, v := range list {
+		buf = serialize(buf, v)
+	}
+	return buf
+}
+
+// Deserialize a list from the given buf, reading each element with the given
+// function, and return the remaining bytes and the deserialized value. Each
+// element must take at least one byte. In case of an error (format error,
+// length larger than the remaining bytes or nil input buffer), nil is returned
+func DeserializeList[T any](buf []byte, deserialize func([]byte) ([]byte, T)) ([]byte, []T) {
+	// read length, each element takes at least one byte
+	buf, size := DeserializeInteger(buf)
+	if buf == nil || size < 0 || size > int64(len(buf)) {
+		return nil, nil
+	}
+
+	// read elements
+	list := make([]T, size)
+	for i := range list {
+		buf, list[i] = deserialize(buf)
+		if buf == nil {
+			return nil, nil
+		}
+	}
+	return buf, list
+}
+
+// Serialize a map to the end of buf and return the new buffer. The number of
+// entries is written first, then each key and value with the given functions.
+// The entries are written in ascending key order, so the same map is always
+// serialized to the same bytes.
+func SerializeMap[K cmp.Ordered, V any](buf []byte, m map[K]V, serializeKey func([]byte, K) []byte, serializeValue func([]byte, V) []byte) []byte {
+	// collect the entries instead of looking the values up by key, which does
+	// not work for NaN keys
+	type entry struct {
+		key   K
+		value V
+	}
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		entries = append(entries, entry{k, v})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Compare(a.key, b.key)
+	})
+
+	// write them
+	buf = SerializeInteger(buf, int64(len(entries)))
+	for _, e := range entries {
+		buf = serializeKey(buf, e.key)
+		buf = serializeValue(buf, e.value)
+	}
+	return buf
+}
+
+// Deserialize a map from the given buf, reading each key and value with the
+// given functions, and return the remaining bytes and the deserialized value.
+// Each key and value must take at least one byte. In case of an error (format
+// error, repeated key, length larger than the remaining bytes or nil input
+// buffer), nil is returned
+func DeserializeMap[K comparable, V any](buf []byte, deserializeKey func([]byte) ([]byte, K), deserializeValue func([]byte) ([]byte, V)) ([]byte, map[K]V) {
+	// read length, each entry takes at least two bytes
+	buf, size := DeserializeInteger(buf)
+	if buf == nil || size < 0 || size > int64(len(buf)/2) {
+		return nil, nil
+	}
+
+	// read entries
+	m := make(map[K]V, size)
+	for i := int64(0); i < size; i++ {
+		var k K
+		var v V
+		buf, k = deserializeKey(buf)
+		if buf == nil {
+			return nil, nil
+		}
+		buf, v = deserializeValue(buf)
+		if buf == nil {
+			return nil, nil
+		}
+		if _, found := m[k]; found {
+			return nil, nil
+		}
+		m[k] = v
+	}
+	return buf, m
+}
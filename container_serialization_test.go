@@ -0,0 +1,103 @@
+package simplerpc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSerialization(t *testing.T) {
+	// serialize
+	buf := SerializeList([]byte{}, []int64{1, 0x20, -1}, SerializeInteger)
+	assert.Equal(t, []byte{
+		3,          // 3 elements
+		1,          // first element
+		0x20, 0x20, // second element
+		0x80, // third element
+	}, buf)
+	assert.Equal(t, []byte{0}, SerializeList([]byte{}, []string(nil), SerializeString))
+
+	// deserialize
+	newbuf, list := DeserializeList(append(buf, 9), DeserializeInteger)
+	assert.Equal(t, []byte{9}, newbuf)
+	assert.Equal(t, []int64{1, 0x20, -1}, list)
+
+	// nested lists
+	nested := [][]string{{"a", "b"}, {}, {"cd"}}
+	serializeInner := func(buf []byte, list []string) []byte {
+		return SerializeList(buf, list, SerializeString)
+	}
+	deserializeInner := func(buf []byte) ([]byte, []string) {
+		return DeserializeList(buf, DeserializeString)
+	}
+	buf = SerializeList([]byte{}, nested, serializeInner)
+	newbuf, nested2 := DeserializeList(buf, deserializeInner)
+	assert.Equal(t, []byte{}, newbuf)
+	assert.Equal(t, nested, nested2)
+
+	// invalid: nil input
+	newbuf, _ = DeserializeList(nil, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: negative length
+	newbuf, _ = DeserializeList([]byte{0x80}, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: hostile length
+	newbuf, _ = DeserializeList([]byte{0x7c, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 2}, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: element fails
+	newbuf, _ = DeserializeList([]byte{2, 1, 0x20}, DeserializeInteger)
+	assert.Nil(t, newbuf)
+}
+
+func TestMapSerialization(t *testing.T) {
+	// serialize, keys are sorted
+	m := map[string]int64{"b": 2, "a": 1, "c": 0x20}
+	buf := SerializeMap([]byte{}, m, SerializeString, SerializeInteger)
+	assert.Equal(t, []byte{
+		3,      // 3 entries
+		1, 'a', // first key
+		1,      // first value
+		1, 'b', // second key
+		2,      // second value
+		1, 'c', // third key
+		0x20, 0x20, // third value
+	}, buf)
+
+	// deserialize
+	newbuf, m2 := DeserializeMap(append(buf, 9), DeserializeString, DeserializeInteger)
+	assert.Equal(t, []byte{9}, newbuf)
+	assert.Equal(t, m, m2)
+
+	// empty map
+	buf = SerializeMap([]byte{}, map[int64]bool{}, SerializeInteger, SerializeBool)
+	assert.Equal(t, []byte{0}, buf)
+	newbuf, m3 := DeserializeMap(buf, DeserializeInteger, DeserializeBool)
+	assert.Equal(t, []byte{}, newbuf)
+	assert.Equal(t, map[int64]bool{}, m3)
+
+	// the value of a NaN key is kept, NaN sorts first
+	buf = SerializeMap([]byte{}, map[float64]int64{math.NaN(): 5, 1: 2}, SerializeFloat64, SerializeInteger)
+	assert.Equal(t, SerializeInteger(SerializeFloat64(SerializeInteger(SerializeFloat64([]byte{2}, math.NaN()), 5), 1), 2), buf)
+
+	// invalid: negative length
+	newbuf, _ = DeserializeMap([]byte{0x80}, DeserializeInteger, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: hostile length
+	newbuf, _ = DeserializeMap([]byte{2, 1, 1}, DeserializeInteger, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: repeated key
+	newbuf, _ = DeserializeMap([]byte{2, 1, 1, 1, 2}, DeserializeInteger, DeserializeInteger)
+	assert.Nil(t, newbuf)
+
+	// invalid: key or value fails
+	newbuf, _ = DeserializeMap([]byte{1, 0x40, 1}, DeserializeInteger, DeserializeInteger)
+	assert.Nil(t, newbuf)
+	newbuf, _ = DeserializeMap([]byte{1, 1, 0x20}, DeserializeInteger, DeserializeInteger)
+	assert.Nil(t, newbuf)
+}
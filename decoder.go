@@ -0,0 +1,146 @@
+package simplerpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors describing why a value could not be decoded
+var (
+	// the input ended before the end of the value
+	ErrTruncated = errors.New("truncated input")
+
+	// the value does not fit into the type it is decoded to
+	ErrOverflow = errors.New("value out of range")
+
+	// a blob or string has a negative length
+	ErrNegativeLength = errors.New("negative length")
+
+	// the value is not valid for its type, e.g. a bool other than 0 or 1
+	ErrInvalidValue = errors.New("invalid value")
+
+	// an integer is not in its shortest form, only returned in strict mode
+	ErrNonCanonical = errors.New("non-canonical encoding")
+)
+
+// Error returned by the decoders, carrying the offset of the value that could
+// not be decoded and the reason, which is one of the errors above
+type DecodeError struct {
+	Offset int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode value at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Decoder reading values from a byte slice one after the other. Unlike the
+// Deserialize functions, its methods return a *DecodeError describing the
+// failure instead of a nil buffer. After a failure the decoder stays at the
+// value that could not be decoded.
+type BufferDecoder struct {
+	buf    []byte
+	offset int
+	strict bool
+}
+
+// Create a new decoder reading the given buffer from the beginning
+func NewBufferDecoder(buf []byte) *BufferDecoder {
+	return &BufferDecoder{
+		buf: buf,
+	}
+}
+
+// Set strict mode, in which integers (including the lengths of blobs and
+// strings) not in their canonical form fail with ErrNonCanonical
+func (d *BufferDecoder) SetStrict(strict bool) {
+	d.strict = strict
+}
+
+// Return the offset of the next value to decode
+func (d *BufferDecoder) Offset() int {
+	return d.offset
+}
+
+// Return the bytes not decoded yet
+func (d *BufferDecoder) Remaining() []byte {
+	return d.buf[d.offset:]
+}
+
+func (d *BufferDecoder) advance(n int, err error) error {
+	if err != nil {
+		return &DecodeError{
+			Offset: d.offset,
+			Err:    err,
+		}
+	}
+	d.offset += n
+	return nil
+}
+
+// Decode an integer
+func (d *BufferDecoder) ReadInteger() (int64, error) {
+	decode := decodeInteger
+	if d.strict {
+		decode = decodeIntegerStrict
+	}
+	v, n, err := decode(d.Remaining())
+	return v, d.advance(n, err)
+}
+
+// Decode an unsigned integer, a negative value is out of range
+func (d *BufferDecoder) ReadUint64() (uint64, error) {
+	decode := decodeUint64
+	if d.strict {
+		decode = decodeUint64Strict
+	}
+	v, n, err := decode(d.Remaining())
+	return v, d.advance(n, err)
+}
+
+func (d *BufferDecoder) decodeBlob() ([]byte, int, error) {
+	if d.strict {
+		return decodeBlobImpl(d.Remaining(), decodeIntegerStrict)
+	}
+	return decodeBlob(d.Remaining())
+}
+
+// Decode a byte slice. The returned slice refers to the decoded buffer.
+func (d *BufferDecoder) ReadBlob() ([]byte, error) {
+	v, n, err := d.decodeBlob()
+	return v, d.advance(n, err)
+}
+
+// Decode a string
+func (d *BufferDecoder) ReadString() (string, error) {
+	v, n, err := d.decodeBlob()
+	return string(v), d.advance(n, err)
+}
+
+// Decode a boolean
+func (d *BufferDecoder) ReadBool() (bool, error) {
+	v, n, err := decodeBool(d.Remaining())
+	return v, d.advance(n, err)
+}
+
+// Decode a 64-bit floating point number
+func (d *BufferDecoder) ReadFloat64() (float64, error) {
+	newbuf, v := DeserializeFloat64(d.Remaining())
+	if newbuf == nil {
+		return 0, d.advance(0, ErrTruncated)
+	}
+	return v, d.advance(8, nil)
+}
+
+// Decode a 32-bit floating point number
+func (d *BufferDecoder) ReadFloat32() (float32, error) {
+	newbuf, v := DeserializeFloat32(d.Remaining())
+	if newbuf == nil {
+		return 0, d.advance(0, ErrTruncated)
+	}
+	return v, d.advance(4, nil)
+}
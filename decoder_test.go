@@ -0,0 +1,120 @@
+package simplerpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferDecoder(t *testing.T) {
+	// decode values one after the other
+	buf := SerializeInteger([]byte{}, -5)
+	buf = SerializeUint64(buf, 1<<63)
+	buf = SerializeString(buf, "ab")
+	buf = SerializeBlob(buf, []byte{7})
+	buf = SerializeBool(buf, true)
+	buf = SerializeFloat64(buf, 1.5)
+	buf = SerializeFloat32(buf, 2.5)
+	buf = append(buf, 9)
+	d := NewBufferDecoder(buf)
+
+	i, err := d.ReadInteger()
+	assert.Nil(t, err)
+	assert.EqualValues(t, -5, i)
+	u, err := d.ReadUint64()
+	assert.Nil(t, err)
+	assert.EqualValues(t, uint64(1<<63), u)
+	s, err := d.ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "ab", s)
+	assert.Equal(t, 13, d.Offset())
+	blob, err := d.ReadBlob()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{7}, blob)
+	b, err := d.ReadBool()
+	assert.Nil(t, err)
+	assert.True(t, b)
+	f64, err := d.ReadFloat64()
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f64)
+	f32, err := d.ReadFloat32()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(2.5), f32)
+	assert.Equal(t, []byte{9}, d.Remaining())
+}
+
+func TestBufferDecoderErrors(t *testing.T) {
+	isError := func(expected error, offset int, err error) {
+		var decodeErr *DecodeError
+		assert.True(t, errors.As(err, &decodeErr))
+		assert.Equal(t, offset, decodeErr.Offset)
+		assert.True(t, errors.Is(err, expected))
+	}
+
+	// truncated integer
+	_, err := NewBufferDecoder(nil).ReadInteger()
+	isError(ErrTruncated, 0, err)
+	_, err = NewBufferDecoder([]byte{0x41, 0}).ReadInteger()
+	isError(ErrTruncated, 0, err)
+
+	// integer not fitting into 63 bits, negative unsigned integer
+	_, err = NewBufferDecoder([]byte{0x7c, 0x80, 0, 0, 0, 0, 0, 0, 0}).ReadInteger()
+	isError(ErrOverflow, 0, err)
+	_, err = NewBufferDecoder([]byte{0x80}).ReadUint64()
+	isError(ErrOverflow, 0, err)
+
+	// blob with negative length or truncated payload, the offset is the start
+	// of the blob
+	d := NewBufferDecoder([]byte{1, 0x80, 'a'})
+	_, err = d.ReadInteger()
+	assert.Nil(t, err)
+	_, err = d.ReadBlob()
+	isError(ErrNegativeLength, 1, err)
+	_, err = NewBufferDecoder([]byte{3, 'a', 'b'}).ReadString()
+	isError(ErrTruncated, 0, err)
+
+	// decoder stays at the failed value
+	assert.Equal(t, 1, d.Offset())
+	assert.Equal(t, []byte{0x80, 'a'}, d.Remaining())
+
+	// invalid bool, truncated floats
+	_, err = NewBufferDecoder([]byte{2}).ReadBool()
+	isError(ErrInvalidValue, 0, err)
+	_, err = NewBufferDecoder([]byte{0, 0, 0, 0}).ReadFloat64()
+	isError(ErrTruncated, 0, err)
+	_, err = NewBufferDecoder([]byte{0, 0, 0}).ReadFloat32()
+	isError(ErrTruncated, 0, err)
+
+	// error message
+	assert.Equal(t, "could not decode value at offset 1: negative length", (&DecodeError{Offset: 1, Err: ErrNegativeLength}).Error())
+}
+
+func TestBufferDecoderStrict(t *testing.T) {
+	// non-canonical integer and blob length
+	buf := []byte{
+		0x20, 0x01, // 1 in mode 01
+		0x20, 0x01, 'a', // blob with length 1 in mode 01
+	}
+
+	// accepted by default
+	d := NewBufferDecoder(buf)
+	v, err := d.ReadInteger()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, v)
+	blob, err := d.ReadBlob()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'a'}, blob)
+
+	// rejected in strict mode
+	d = NewBufferDecoder(buf)
+	d.SetStrict(true)
+	_, err = d.ReadInteger()
+	assert.Equal(t, &DecodeError{Offset: 0, Err: ErrNonCanonical}, err)
+	_, err = d.ReadUint64()
+	assert.Equal(t, &DecodeError{Offset: 0, Err: ErrNonCanonical}, err)
+	d = NewBufferDecoder(buf[2:])
+	d.SetStrict(true)
+	_, err = d.ReadString()
+	assert.Equal(t, &DecodeError{Offset: 0, Err: ErrNonCanonical}, err)
+}
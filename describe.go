@@ -0,0 +1,138 @@
+package simplerpc
+
+import "context"
+
+// Description of a parameter of a service function
+type ParameterDescription struct {
+	Name string
+	Type string
+}
+
+// Description of a service function. The types are given as type names of the
+// service file, e.g. Integer, String or Blob.
+type FunctionDescription struct {
+	Id         int64
+	Name       string
+	Parameters []ParameterDescription
+	ReturnType string
+}
+
+// Description of a service returned by the describe service function of the
+// server. Id and Revision are filled by the server from the service.
+type ServiceDescription struct {
+	Id        int64
+	Revision  string
+	Name      string
+	Functions []FunctionDescription
+}
+
+// Optional interface a service can implement to describe itself, so generic
+// clients can discover its functions at runtime. Services not implementing it
+// are described with their id and revision only.
+type ServiceDescriptor interface {
+	DescribeService() ServiceDescription
+}
+
+func serializeParameterDescription(buf []byte, param ParameterDescription) []byte {
+	buf = SerializeString(buf, param.Name)
+	return SerializeString(buf, param.Type)
+}
+
+func deserializeParameterDescription(buf []byte) (newbuf []byte, param ParameterDescription) {
+	buf, param.Name = DeserializeString(buf)
+	buf, param.Type = DeserializeString(buf)
+	return buf, param
+}
+
+func serializeFunctionDescription(buf []byte, function FunctionDescription) []byte {
+	buf = SerializeInteger(buf, function.Id)
+	buf = SerializeString(buf, function.Name)
+	buf = SerializeList(buf, function.Parameters, serializeParameterDescription)
+	return SerializeString(buf, function.ReturnType)
+}
+
+func deserializeFunctionDescription(buf []byte) (newbuf []byte, function FunctionDescription) {
+	buf, function.Id = DeserializeInteger(buf)
+	buf, function.Name = DeserializeString(buf)
+	buf, function.Parameters = DeserializeList(buf, deserializeParameterDescription)
+	buf, function.ReturnType = DeserializeString(buf)
+	return buf, function
+}
+
+// Serialize a service description to the end of buf and return the new buffer
+func SerializeServiceDescription(buf []byte, desc ServiceDescription) []byte {
+	buf = SerializeInteger(buf, desc.Id)
+	buf = SerializeString(buf, desc.Revision)
+	buf = SerializeString(buf, desc.Name)
+	return SerializeList(buf, desc.Functions, serializeFunctionDescription)
+}
+
+// Deserialize a service description from the given buf and return the
+// remaining bytes and the deserialized value. In case of an error (format error
+// or nil input buffer), nil is returned
+func DeserializeServiceDescription(buf []byte) (newbuf []byte, desc ServiceDescription) {
+	buf, desc.Id = DeserializeInteger(buf)
+	buf, desc.Revision = DeserializeString(buf)
+	buf, desc.Name = DeserializeString(buf)
+	buf, desc.Functions = DeserializeList(buf, deserializeFunctionDescription)
+	if buf == nil {
+		return nil, ServiceDescription{}
+	}
+	return buf, desc
+}
+
+func (srv Server) handleServerRequestDescribeService(requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// read service id
+	requestBytes, serviceId := DeserializeInteger(requestBytes)
+	if requestBytes == nil {
+		return nil, NewError(ErrorCodeMalformedRequest, "invalid service id")
+	}
+
+	// find service
+	service, found := srv.registry.get(serviceId)
+	if !found {
+		return nil, NewError(ErrorCodeUnknownService, "no service with id %d", serviceId)
+	}
+
+	// describe it
+	desc, err := srv.describeService(service)
+	if err != nil {
+		return nil, err
+	}
+	return SerializeServiceDescription(respBytes, desc), nil
+}
+
+// Get the description of a service. A panicking description is recovered like
+// a panicking service function.
+func (srv Server) describeService(service ServerService) (desc ServiceDescription, err error) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		srv.reportPanic("service description panicked", service.GetServiceId(), ServerFunctionDescribeService, value)
+		desc, err = ServiceDescription{}, NewError(ErrorCodePanic, "")
+	}()
+	if descriptor, ok := service.(ServiceDescriptor); ok {
+		desc = descriptor.DescribeService()
+	}
+	desc.Id = service.GetServiceId()
+	desc.Revision = service.GetRevision()
+	return desc, nil
+}
+
+// Get the description of the service with the given id from the server
+func (c *Client) DescribeService(ctx context.Context, serviceId int64) (ServiceDescription, error) {
+	// call the describe service function of the server
+	resp, err := c.Call(ctx, 0, ServerFunctionDescribeService, SerializeInteger(nil, serviceId))
+	if err != nil {
+		return ServiceDescription{}, err
+	}
+
+	// deserialize the response
+	resp, desc := DeserializeServiceDescription(resp)
+	if resp == nil {
+		return ServiceDescription{}, ErrInvalidResponse
+	}
+	return desc, nil
+}
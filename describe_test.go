@@ -0,0 +1,193 @@
+package simplerpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type describedTestService struct {
+	testService
+}
+
+func (srv *describedTestService) DescribeService() ServiceDescription {
+	return ServiceDescription{
+		Name: "Test",
+		Functions: []FunctionDescription{
+			{
+				Id:   id_testfunc_append_string,
+				Name: "appendString",
+				Parameters: []ParameterDescription{
+					{Name: "s", Type: "String"},
+				},
+				ReturnType: "String",
+			},
+			{
+				Id:   id_testfunc_add_nums,
+				Name: "addNums",
+				Parameters: []ParameterDescription{
+					{Name: "a", Type: "Integer"},
+					{Name: "b", Type: "Integer"},
+				},
+				ReturnType: "Integer",
+			},
+		},
+	}
+}
+
+type panickingDescribedService struct {
+	testService
+}
+
+func (srv *panickingDescribedService) DescribeService() ServiceDescription {
+	panic("no description")
+}
+
+func TestServiceDescriptionSerialization(t *testing.T) {
+	// serialize
+	desc := (&describedTestService{}).DescribeService()
+	desc.Id = 7
+	desc.Revision = "r"
+	buf := SerializeServiceDescription([]byte{}, desc)
+	assert.Equal(t, []byte{
+		7,      // id
+		1, 'r', // revision
+		4, 'T', 'e', 's', 't', // name
+		2,                                                              // 2 functions
+		1,                                                              // first function, id
+		12, 'a', 'p', 'p', 'e', 'n', 'd', 'S', 't', 'r', 'i', 'n', 'g', // first function, name
+		1,      // first function, 1 parameter
+		1, 's', // parameter name
+		6, 'S', 't', 'r', 'i', 'n', 'g', // parameter type
+		6, 'S', 't', 'r', 'i', 'n', 'g', // first function, return type
+	}, buf[:40])
+
+	// deserialize
+	rest, desc2 := DeserializeServiceDescription(append(buf, 9))
+	assert.Equal(t, []byte{9}, rest)
+	assert.Equal(t, desc, desc2)
+
+	// invalid: truncated
+	for i := 0; i < len(buf); i++ {
+		rest, _ = DeserializeServiceDescription(buf[:i])
+		assert.Nil(t, rest)
+	}
+
+	// invalid: hostile function count
+	rest, _ = DeserializeServiceDescription([]byte{1, 0, 0, 0x7c, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Nil(t, rest)
+}
+
+func TestServerDescribeService(t *testing.T) {
+	// create server with a described and a plain service
+	server, _ := NewServer([]ServerService{
+		&describedTestService{
+			testService: testService{id: 1, revision: "x"},
+		},
+		&testService{
+			id:       2,
+			revision: "y",
+		},
+	})
+
+	// describe the first one
+	req := []byte{
+		1, // request id
+		0, // service id
+		5, // function id: describe service
+		1, // service id to describe
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	desc := (&describedTestService{}).DescribeService()
+	desc.Id = 1
+	desc.Revision = "x"
+	assert.Equal(t, SerializeServiceDescription([]byte{
+		1, // request id
+		1, // success
+	}, desc), resp)
+
+	// describe the second one
+	req = []byte{
+		2, // request id
+		0, // service id
+		5, // function id: describe service
+		2, // service id to describe
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		2,      // request id
+		1,      // success
+		2,      // id
+		1, 'y', // revision
+		0, // name
+		0, // 0 functions
+	}, resp)
+
+	// unknown service
+	req = []byte{
+		3, // request id
+		0, // service id
+		5, // function id: describe service
+		3, // service id to describe
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		3, // request id
+		2, // error
+	}, NewError(ErrorCodeUnknownService, "no service with id 3")), resp)
+}
+
+func TestServerDescribeServicePanic(t *testing.T) {
+	// create server with a service whose description panics
+	var panicked []int64
+	server, _ := NewServerWithOptions([]ServerService{
+		&panickingDescribedService{
+			testService: testService{id: 1},
+		},
+	}, WithPanicHandler(func(serviceId, functionId int64, value any, stack []byte) {
+		panicked = append(panicked, serviceId, functionId)
+	}))
+
+	// describe it
+	req := []byte{
+		1, // request id
+		0, // service id
+		5, // function id: describe service
+		1, // service id to describe
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodePanic, "")), resp)
+	assert.Equal(t, []int64{1, ServerFunctionDescribeService}, panicked)
+}
+
+func TestClientDescribeService(t *testing.T) {
+	// create server and client
+	server, _ := NewServer([]ServerService{
+		&describedTestService{
+			testService: testService{id: 1, revision: "x"},
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// describe the service
+	desc, err := client.DescribeService(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "Test", desc.Name)
+	assert.Equal(t, "x", desc.Revision)
+	assert.Len(t, desc.Functions, 2)
+	assert.Equal(t, "addNums", desc.Functions[1].Name)
+
+	// unknown service
+	_, err = client.DescribeService(context.Background(), 2)
+	assert.Equal(t, NewError(ErrorCodeUnknownService, "no service with id 2"), err)
+
+	// done
+	client.Close()
+	assert.Nil(t, stop())
+}
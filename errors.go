@@ -0,0 +1,144 @@
+package simplerpc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status written after the request id in a response
+const (
+	// failure without details, written by older servers
+	StatusFailure int64 = 0
+
+	// success, followed by the return value
+	StatusSuccess int64 = 1
+
+	// failure, followed by an error code and a message
+	StatusError int64 = 2
+)
+
+// Code describing the reason of a failed request
+type ErrorCode int64
+
+// Error codes used by the library. Codes below ErrorCodeApplication, including
+// zero and negative ones, are reserved for the library, new ones may be added
+// there in later versions.
+const (
+	ErrorCodeUnknownService   ErrorCode = 1
+	ErrorCodeUnknownFunction  ErrorCode = 2
+	ErrorCodeMalformedRequest ErrorCode = 3
+	ErrorCodeCancelled        ErrorCode = 4
+	ErrorCodeHandlerError     ErrorCode = 5
+	ErrorCodePanic            ErrorCode = 6
+	ErrorCodeTimedOut         ErrorCode = 7
+	ErrorCodeRequestTooLarge  ErrorCode = 8
+	ErrorCodeOverloaded       ErrorCode = 9
+	ErrorCodeRateLimited      ErrorCode = 10
+)
+
+// First error code available for application errors. Services can use this
+// code and the ones above it for their own errors without colliding with the
+// codes of the library.
+const ErrorCodeApplication ErrorCode = 1000
+
+func (code ErrorCode) String() string {
+	switch code {
+	case ErrorCodeUnknownService:
+		return "unknown service"
+	case ErrorCodeUnknownFunction:
+		return "unknown function"
+	case ErrorCodeMalformedRequest:
+		return "malformed request"
+	case ErrorCodeCancelled:
+		return "cancelled"
+	case ErrorCodeHandlerError:
+		return "handler error"
+	case ErrorCodePanic:
+		return "handler panicked"
+	case ErrorCodeTimedOut:
+		return "timed out"
+	case ErrorCodeRequestTooLarge:
+		return "request too large"
+	case ErrorCodeOverloaded:
+		return "overloaded"
+	case ErrorCodeRateLimited:
+		return "rate limited"
+	default:
+		return fmt.Sprintf("error code %d", int64(code))
+	}
+}
+
+// Error type carried by failed responses
+type Error struct {
+	Code    ErrorCode
+	Message string
+
+	// time after which the call may succeed, only sent with the
+	// ErrorCodeRateLimited code
+	RetryAfter time.Duration
+}
+
+// Create a new error with the given code and formatted message
+func NewError(code ErrorCode, format string, args ...any) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code.String()
+	}
+	return e.Code.String() + ": " + e.Message
+}
+
+// Convert any error to an Error. Errors not wrapping an Error are handler errors.
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{
+		Code:    ErrorCodeHandlerError,
+		Message: err.Error(),
+	}
+}
+
+// Serialize an error to the end of buf and return the new buffer. Errors with
+// the ErrorCodeRateLimited code are followed by the retry after time in
+// milliseconds, rounded up.
+func SerializeError(buf []byte, e *Error) []byte {
+	buf = SerializeInteger(buf, int64(e.Code))
+	buf = SerializeString(buf, e.Message)
+	if e.Code == ErrorCodeRateLimited {
+		// round up, so the caller does not retry too early
+		retryAfter_ms := e.RetryAfter.Milliseconds()
+		if e.RetryAfter%time.Millisecond > 0 {
+			retryAfter_ms++
+		}
+		buf = SerializeInteger(buf, retryAfter_ms)
+	}
+	return buf
+}
+
+// Deserialize an error from the given buf and return the remaining bytes and
+// the deserialized value. In case of an error (format error or nil input buffer),
+// nil is returned
+func DeserializeError(buf []byte) ([]byte, *Error) {
+	buf, code := DeserializeInteger(buf)
+	buf, message := DeserializeString(buf)
+	var retryAfter_ms int64
+	if ErrorCode(code) == ErrorCodeRateLimited {
+		buf, retryAfter_ms = DeserializeInteger(buf)
+	}
+	if buf == nil {
+		return nil, nil
+	}
+	return buf, &Error{
+		Code:       ErrorCode(code),
+		Message:    message,
+		RetryAfter: time.Duration(retryAfter_ms) * time.Millisecond,
+	}
+}
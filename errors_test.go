@@ -0,0 +1,75 @@
+package simplerpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorSerialization(t *testing.T) {
+	// serialize
+	buf := SerializeError([]byte{}, NewError(ErrorCodeUnknownService, "no service %d", 5))
+	assert.Equal(t, []byte{
+		1,                                                              // code
+		12, 'n', 'o', ' ', 's', 'e', 'r', 'v', 'i', 'c', 'e', ' ', '5', // message
+	}, buf)
+
+	// deserialize
+	rest, e := DeserializeError(append(buf, 9))
+	assert.Equal(t, []byte{9}, rest)
+	assert.Equal(t, &Error{Code: ErrorCodeUnknownService, Message: "no service 5"}, e)
+
+	// invalid: missing message
+	rest, e = DeserializeError([]byte{1})
+	assert.Nil(t, rest)
+	assert.Nil(t, e)
+}
+
+func TestRateLimitedErrorSerialization(t *testing.T) {
+	// the retry after time follows the message
+	e := NewError(ErrorCodeRateLimited, "x")
+	e.RetryAfter = time.Millisecond * 300
+	buf := SerializeError([]byte{}, e)
+	assert.Equal(t, []byte{
+		10,     // code
+		1, 'x', // message
+		0x21, 0x2c, // retry after=300ms
+	}, buf)
+
+	// deserialize
+	rest, e2 := DeserializeError(append(buf, 9))
+	assert.Equal(t, []byte{9}, rest)
+	assert.Equal(t, e, e2)
+
+	// retry after time is rounded up to milliseconds
+	e.RetryAfter = time.Microsecond * 300
+	_, e2 = DeserializeError(SerializeError([]byte{}, e))
+	assert.Equal(t, time.Millisecond, e2.RetryAfter)
+	e.RetryAfter = time.Millisecond*2 + time.Nanosecond
+	_, e2 = DeserializeError(SerializeError([]byte{}, e))
+	assert.Equal(t, time.Millisecond*3, e2.RetryAfter)
+
+	// invalid: missing retry after time
+	rest, e2 = DeserializeError([]byte{10, 1, 'x'})
+	assert.Nil(t, rest)
+	assert.Nil(t, e2)
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "unknown function: no function 3", NewError(ErrorCodeUnknownFunction, "no function 3").Error())
+	assert.Equal(t, "cancelled", NewError(ErrorCodeCancelled, "").Error())
+	assert.Equal(t, "rate limited: slow down", NewError(ErrorCodeRateLimited, "slow down").Error())
+	assert.Equal(t, "error code 1000: custom", NewError(ErrorCodeApplication, "custom").Error())
+}
+
+func TestToError(t *testing.T) {
+	// errors wrapping an Error are kept
+	e := NewError(ErrorCodeMalformedRequest, "bad")
+	assert.Same(t, e, toError(fmt.Errorf("wrapped: %w", e)))
+
+	// other errors become handler errors
+	assert.Equal(t, NewError(ErrorCodeHandlerError, "oops"), toError(errors.New("oops")))
+}
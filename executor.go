@@ -0,0 +1,108 @@
+package simplerpc
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Statistics of the executor limiting the concurrent service function calls
+type ExecutorStats struct {
+	// number of service function calls running
+	Running int64
+
+	// number of service function calls waiting for a free slot
+	Queued int64
+
+	// number of service function calls rejected because the queue was full
+	Rejected uint64
+}
+
+// Executor limiting the number of service function calls running at the same
+// time, globally and per service. A call not getting a slot waits in a bounded
+// queue, and is rejected when the queue is full. Nil channels mean no limit.
+type executor struct {
+	global    chan struct{}
+	services  map[int64]chan struct{}
+	maxQueued int64
+	running   atomic.Int64
+	queued    atomic.Int64
+	rejected  atomic.Uint64
+}
+
+func tryAcquireSlot(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func waitForSlot(ctx context.Context, slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+func (e *executor) acquire(ctx context.Context, serviceId int64) error {
+	// take the slots without waiting if possible
+	serviceSlots := e.services[serviceId]
+	gotServiceSlot := tryAcquireSlot(serviceSlots)
+	if gotServiceSlot && tryAcquireSlot(e.global) {
+		e.running.Add(1)
+		return nil
+	}
+
+	// otherwise wait in the queue, if it is not full
+	if e.queued.Add(1) > e.maxQueued {
+		e.queued.Add(-1)
+		e.rejected.Add(1)
+		if gotServiceSlot {
+			releaseSlot(serviceSlots)
+		}
+		return NewError(ErrorCodeOverloaded, "too many concurrent requests")
+	}
+	defer e.queued.Add(-1)
+	if !gotServiceSlot && !waitForSlot(ctx, serviceSlots) {
+		return NewError(ErrorCodeCancelled, "request was cancelled while queued")
+	}
+	if !waitForSlot(ctx, e.global) {
+		releaseSlot(serviceSlots)
+		return NewError(ErrorCodeCancelled, "request was cancelled while queued")
+	}
+
+	// done
+	e.running.Add(1)
+	return nil
+}
+
+func (e *executor) release(serviceId int64) {
+	e.running.Add(-1)
+	releaseSlot(e.global)
+	releaseSlot(e.services[serviceId])
+}
+
+// Get the statistics of the executor limiting the concurrent service function
+// calls, see WithMaxConcurrentRequests
+func (srv Server) ExecutorStats() ExecutorStats {
+	return ExecutorStats{
+		Running:  srv.executor.running.Load(),
+		Queued:   srv.executor.queued.Load(),
+		Rejected: srv.executor.rejected.Load(),
+	}
+}
@@ -0,0 +1,147 @@
+package simplerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutorQueue(t *testing.T) {
+	// create server allowing 1 running and 1 queued call
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithMaxConcurrentRequests(1), WithMaxQueuedRequests(1))
+
+	// start a slow call, then queue another one
+	slowDone := startSlowCall(server.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+	queuedDone := make(chan []byte)
+	go func() {
+		req := []byte{
+			2,                    // request id
+			1,                    // service id
+			id_testfunc_add_nums, // function id
+			2, 3,                 // nums
+		}
+		queuedDone <- server.ProcessRequest(context.Background(), req, nil)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, ExecutorStats{Running: 1, Queued: 1}, server.ExecutorStats())
+
+	// the queue is full, another call is rejected
+	req := []byte{
+		3,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		3, // request id
+		2, // error
+	}, NewError(ErrorCodeOverloaded, "too many concurrent requests")), resp)
+	assert.Equal(t, ExecutorStats{Running: 1, Queued: 1, Rejected: 1}, server.ExecutorStats())
+
+	// the queued call runs once the slow one finished
+	assert.Equal(t, []byte{1, 1}, <-slowDone)
+	assert.Equal(t, []byte{2, 1, 5}, <-queuedDone)
+	assert.Equal(t, ExecutorStats{Rejected: 1}, server.ExecutorStats())
+}
+
+func TestExecutorPerServiceLimit(t *testing.T) {
+	// create server allowing 1 running call of service 1
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+		&testService{
+			id: 2,
+		},
+	}, WithMaxConcurrentRequestsPerService(1, 1))
+
+	// start a slow call on service 1
+	slowDone := startSlowCall(server.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+
+	// service 2 is not limited
+	req := []byte{
+		2,                    // request id
+		2,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{2, 1, 5}, resp)
+
+	// service 1 is
+	req = []byte{
+		3,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		3, // request id
+		2, // error
+	}, NewError(ErrorCodeOverloaded, "too many concurrent requests")), resp)
+	assert.Equal(t, []byte{1, 1}, <-slowDone)
+}
+
+func TestExecutorQueuedCallCancelled(t *testing.T) {
+	// create server allowing 1 running call and queueing the rest
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithMaxConcurrentRequests(1), WithMaxQueuedRequests(10))
+
+	// start a slow call
+	slowDone := startSlowCall(server.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+
+	// a queued call times out
+	req := []byte{
+		2,                    // request id
+		0x81,                 // service id=1 with timeout
+		id_testfunc_add_nums, // function id
+		0x20, 50,             // timeout=50ms
+		2, 3, // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeTimedOut, "deadline exceeded")), resp)
+
+	// a queued call is cancelled by the cancel function
+	queuedDone := make(chan []byte)
+	go func() {
+		req := []byte{
+			3,                    // request id
+			1,                    // service id
+			id_testfunc_add_nums, // function id
+			2, 3,                 // nums
+		}
+		queuedDone <- server.ProcessRequest(context.Background(), req, nil)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	req = []byte{
+		4, // request id
+		0, // service id
+		1, // function id: cancel
+		3, // request id to cancel
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{4, 1, byte(CancelResultFound)}, resp)
+	assert.Equal(t, SerializeError([]byte{
+		3, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 3 was cancelled")), <-queuedDone)
+	assert.Equal(t, ExecutorStats{Running: 1}, server.ExecutorStats())
+	assert.Equal(t, []byte{1, 1}, <-slowDone)
+}
@@ -0,0 +1,55 @@
+package simplerpc
+
+import "context"
+
+// Function handling a call on a service: either the next interceptor of the
+// chain or the service function itself
+type ServerCallFunc func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error)
+
+// Interceptor wrapping the calls on the services. It receives the call and the
+// next handler of the chain, and it can either call next (possibly with a
+// modified context or request), or short-circuit the call by returning an error
+// without calling next. The service is selected before the chain is called, so
+// changing the service id passed to next has no effect.
+type ServerInterceptor func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error)
+
+// Add interceptors wrapping the calls on the services. The interceptors are
+// called in the order they are given, the first one being the outermost. The
+// functions of the server itself (service id 0) are not intercepted.
+func WithInterceptors(interceptors ...ServerInterceptor) ServerOption {
+	return func(srv *Server) {
+		srv.interceptors = append(srv.interceptors, interceptors...)
+	}
+}
+
+func chainInterceptor(interceptor ServerInterceptor, next ServerCallFunc) ServerCallFunc {
+	return func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+		return interceptor(ctx, requestId, serviceId, functionId, requestBytes, respBytes, next)
+	}
+}
+
+func (srv Server) callFunctionWithInterceptors(ctx context.Context, service ServerService, requestId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// no interceptors, call the service directly
+	if len(srv.interceptors) == 0 {
+		return srv.callFunctionOnService(ctx, service, requestId, functionId, requestBytes, respBytes)
+	}
+
+	// build the chain from the innermost call. It captures a copy of the
+	// server, so the server is only moved to the heap when there are
+	// interceptors.
+	chainSrv := srv
+	var call ServerCallFunc = func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+		return chainSrv.callFunctionOnService(ctx, service, requestId, functionId, requestBytes, respBytes)
+	}
+	for i := len(srv.interceptors) - 1; i >= 0; i-- {
+		call = chainInterceptor(srv.interceptors[i], call)
+	}
+
+	// call the chain, an interceptor returning no result and no error is a failure too
+	serviceId := service.GetServiceId()
+	respBytes, err := call(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+	if err == nil && respBytes == nil {
+		err = NewError(ErrorCodeHandlerError, "function %d of service %d failed", functionId, serviceId)
+	}
+	return respBytes, err
+}
@@ -0,0 +1,120 @@
+package simplerpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptorsOrder(t *testing.T) {
+	// create server with 2 interceptors recording the calls
+	var calls []string
+	record := func(name string) ServerInterceptor {
+		return func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error) {
+			calls = append(calls, name+" before")
+			respBytes, err := next(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+			calls = append(calls, name+" after")
+			return respBytes, err
+		}
+	}
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithInterceptors(record("first"), record("second")))
+
+	// call a function
+	req := []byte{
+		1,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1, // request id
+		1, // success
+		5, // result
+	}, resp)
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, calls)
+
+	// server functions are not intercepted
+	calls = nil
+	req = []byte{
+		2, // request id
+		0, // service id
+		0, // function id: get services
+	}
+	server.ProcessRequest(context.Background(), req, nil)
+	assert.Empty(t, calls)
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	// create server with an interceptor rejecting odd function ids
+	service := &testService{
+		id: 1,
+	}
+	server, _ := NewServerWithOptions([]ServerService{service}, WithInterceptors(
+		func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error) {
+			if functionId%2 == 1 {
+				return nil, NewError(ErrorCodeApplication+403, "function %d is not allowed", functionId)
+			}
+			return next(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+		},
+	))
+
+	// rejected call
+	req := []byte{
+		1,                         // request id
+		1,                         // service id
+		id_testfunc_append_string, // function id
+		1, 'a',                    // string
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeApplication+403, "function 1 is not allowed")), resp)
+	assert.Equal(t, "", service.value)
+
+	// allowed call
+	req = []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		2, // request id
+		1, // success
+		5, // result
+	}, resp)
+}
+
+func TestInterceptorNoResult(t *testing.T) {
+	// create server with an interceptor returning neither result nor error
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithInterceptors(
+		func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error) {
+			return nil, nil
+		},
+	))
+
+	// the call fails
+	req := []byte{
+		1,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeHandlerError, "function 2 of service 1 failed")), resp)
+}
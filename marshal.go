@@ -0,0 +1,419 @@
+package simplerpc
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Error returned by Unmarshal when the input does not match the format of the
+// type being unmarshalled
+var ErrInvalidFormat = errors.New("invalid format")
+
+// Serialization plan of a type, built once per type and cached
+type typeCodec struct {
+	marshal   func(buf []byte, v reflect.Value) []byte
+	unmarshal func(buf []byte, v reflect.Value) []byte
+}
+
+var typeCodecs sync.Map // reflect.Type -> *typeCodec
+
+// Serialize v to the end of buf using the primitive serializers and return the
+// new buffer. Unlike the Serialize functions, a nil buf starts a new buffer. If
+// v is a pointer, the value it points to is serialized. The supported types
+// are:
+//   - signed integers as Integer, unsigned integers as unsigned integer
+//   - string as String, []byte as Blob, bool as Bool
+//   - float64 and float32 as Float64 and Float32
+//   - pointers as optional values, nil meaning absent
+//   - slices as lists, maps with integer, float or string keys as maps
+//   - structs as their exported fields in declaration order, except the ones
+//     tagged with `simplerpc:"-"`, other simplerpc tag values are not supported
+//
+// Return error if v (or a type it contains) is not supported.
+func Marshal(buf []byte, v any) ([]byte, error) {
+	// get the value, dereferencing a pointer
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, errors.New("could not marshal: nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, errors.New("could not marshal: nil value")
+	}
+
+	// get the plan and serialize, starting a new buffer if there is none since
+	// SerializeString does nothing with nil input
+	codec, err := getTypeCodec(rv.Type())
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal: %w", err)
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return codec.marshal(buf, rv), nil
+}
+
+// Deserialize a value from buf into the value v points to, using the same
+// format as Marshal, and return the remaining bytes. Return error if v is not a
+// non-nil pointer to a supported type, or if buf does not contain a valid value
+// of the type.
+func Unmarshal(buf []byte, v any) ([]byte, error) {
+	// get the value pointed to
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, errors.New("could not unmarshal: not a non-nil pointer")
+	}
+	rv = rv.Elem()
+
+	// get the plan and deserialize
+	codec, err := getTypeCodec(rv.Type())
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal: %w", err)
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("could not unmarshal %s: %w", rv.Type(), ErrInvalidFormat)
+	}
+	newbuf := codec.unmarshal(buf, rv)
+	if newbuf == nil {
+		return nil, fmt.Errorf("could not unmarshal %s: %w", rv.Type(), ErrInvalidFormat)
+	}
+	return newbuf, nil
+}
+
+func getTypeCodec(t reflect.Type) (*typeCodec, error) {
+	// check cache
+	if codec, found := typeCodecs.Load(t); found {
+		return codec.(*typeCodec), nil
+	}
+
+	// build the plan and cache it
+	codec, err := buildTypeCodec(t, map[reflect.Type]*typeCodec{})
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := typeCodecs.LoadOrStore(t, codec)
+	return actual.(*typeCodec), nil
+}
+
+func buildTypeCodec(t reflect.Type, inProgress map[reflect.Type]*typeCodec) (*typeCodec, error) {
+	// the type may already be in progress if it is recursive, its functions
+	// are filled by the time they are called
+	if codec, found := inProgress[t]; found {
+		return codec, nil
+	}
+	codec := &typeCodec{}
+	inProgress[t] = codec
+
+	// fill the functions depending on the kind
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeInteger(buf, v.Int())
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, n := DeserializeInteger(buf)
+			if buf == nil || v.OverflowInt(n) {
+				return nil
+			}
+			v.SetInt(n)
+			return buf
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeUint64(buf, v.Uint())
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, n := DeserializeUint64(buf)
+			if buf == nil || v.OverflowUint(n) {
+				return nil
+			}
+			v.SetUint(n)
+			return buf
+		}
+	case reflect.String:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeString(buf, v.String())
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, s := DeserializeString(buf)
+			if buf != nil {
+				v.SetString(s)
+			}
+			return buf
+		}
+	case reflect.Bool:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeBool(buf, v.Bool())
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, b := DeserializeBool(buf)
+			if buf != nil {
+				v.SetBool(b)
+			}
+			return buf
+		}
+	case reflect.Float64:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeFloat64(buf, v.Float())
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, f := DeserializeFloat64(buf)
+			if buf != nil {
+				v.SetFloat(f)
+			}
+			return buf
+		}
+	case reflect.Float32:
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			return SerializeFloat32(buf, float32(v.Float()))
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, f := DeserializeFloat32(buf)
+			if buf != nil {
+				v.SetFloat(float64(f))
+			}
+			return buf
+		}
+	case reflect.Pointer:
+		return codec, buildPointerCodec(codec, t, inProgress)
+	case reflect.Slice:
+		return codec, buildSliceCodec(codec, t, inProgress)
+	case reflect.Map:
+		return codec, buildMapCodec(codec, t, inProgress)
+	case reflect.Struct:
+		return codec, buildStructCodec(codec, t, inProgress)
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", t)
+	}
+	return codec, nil
+}
+
+func buildPointerCodec(codec *typeCodec, t reflect.Type, inProgress map[reflect.Type]*typeCodec) error {
+	// get the plan of the element
+	elem, err := buildTypeCodec(t.Elem(), inProgress)
+	if err != nil {
+		return err
+	}
+
+	// optional value
+	codec.marshal = func(buf []byte, v reflect.Value) []byte {
+		if v.IsNil() {
+			return SerializeBool(buf, false)
+		}
+		buf = SerializeBool(buf, true)
+		return elem.marshal(buf, v.Elem())
+	}
+	codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+		buf, present := DeserializeBool(buf)
+		if buf == nil || !present {
+			v.SetZero()
+			return buf
+		}
+		ptr := reflect.New(t.Elem())
+		buf = elem.unmarshal(buf, ptr.Elem())
+		if buf != nil {
+			v.Set(ptr)
+		}
+		return buf
+	}
+	return nil
+}
+
+func buildSliceCodec(codec *typeCodec, t reflect.Type, inProgress map[reflect.Type]*typeCodec) error {
+	// byte slice is a blob
+	if t.Elem().Kind() == reflect.Uint8 {
+		codec.marshal = func(buf []byte, v reflect.Value) []byte {
+			buf = SerializeInteger(buf, int64(v.Len()))
+			return append(buf, v.Bytes()...)
+		}
+		codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+			buf, data := DeserializeBlob(buf)
+			if buf != nil {
+				v.SetBytes(slices.Clone(data))
+			}
+			return buf
+		}
+		return nil
+	}
+
+	// get the plan of the element
+	elem, err := buildTypeCodec(t.Elem(), inProgress)
+	if err != nil {
+		return err
+	}
+
+	// list
+	codec.marshal = func(buf []byte, v reflect.Value) []byte {
+		size := v.Len()
+		buf = SerializeInteger(buf, int64(size))
+		for i := 0; i < size; i++ {
+			buf = elem.marshal(buf, v.Index(i))
+		}
+		return buf
+	}
+	codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+		// read length, limited by the remaining bytes
+		buf, size := DeserializeInteger(buf)
+		if buf == nil || size < 0 || size > int64(len(buf)) {
+			return nil
+		}
+
+		// read elements
+		list := reflect.MakeSlice(t, int(size), int(size))
+		for i := 0; i < int(size); i++ {
+			buf = elem.unmarshal(buf, list.Index(i))
+			if buf == nil {
+				return nil
+			}
+		}
+		v.Set(list)
+		return buf
+	}
+	return nil
+}
+
+func compareMapKeys(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	default:
+		return strings.Compare(a.String(), b.String())
+	}
+}
+
+func isNaNKey(k reflect.Value) bool {
+	switch k.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return math.IsNaN(k.Float())
+	default:
+		return false
+	}
+}
+
+func buildMapCodec(codec *typeCodec, t reflect.Type, inProgress map[reflect.Type]*typeCodec) error {
+	// keys must be ordered so the map is always serialized to the same bytes
+	switch t.Key().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+	default:
+		return fmt.Errorf("unsupported map key type: %s", t.Key())
+	}
+
+	// get the plans of the keys and values
+	key, err := buildTypeCodec(t.Key(), inProgress)
+	if err != nil {
+		return err
+	}
+	value, err := buildTypeCodec(t.Elem(), inProgress)
+	if err != nil {
+		return err
+	}
+
+	// map
+	codec.marshal = func(buf []byte, v reflect.Value) []byte {
+		// collect the entries instead of looking the values up by key, which
+		// does not work for NaN keys
+		entries := make([][2]reflect.Value, 0, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			entries = append(entries, [2]reflect.Value{iter.Key(), iter.Value()})
+		}
+		slices.SortFunc(entries, func(a, b [2]reflect.Value) int {
+			return compareMapKeys(a[0], b[0])
+		})
+
+		// write them
+		buf = SerializeInteger(buf, int64(len(entries)))
+		for _, e := range entries {
+			buf = key.marshal(buf, e[0])
+			buf = value.marshal(buf, e[1])
+		}
+		return buf
+	}
+	codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+		// read length, limited by the remaining bytes
+		buf, size := DeserializeInteger(buf)
+		if buf == nil || size < 0 || size > int64(len(buf)/2) {
+			return nil
+		}
+
+		// read entries, rejecting repeated keys. NaN keys are never found in
+		// the map, so they are counted separately.
+		m := reflect.MakeMapWithSize(t, int(size))
+		hasNaNKey := false
+		for i := 0; i < int(size); i++ {
+			k := reflect.New(t.Key()).Elem()
+			buf = key.unmarshal(buf, k)
+			if buf == nil || m.MapIndex(k).IsValid() {
+				return nil
+			}
+			if isNaNKey(k) {
+				if hasNaNKey {
+					return nil
+				}
+				hasNaNKey = true
+			}
+			e := reflect.New(t.Elem()).Elem()
+			buf = value.unmarshal(buf, e)
+			if buf == nil {
+				return nil
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+		return buf
+	}
+	return nil
+}
+
+func buildStructCodec(codec *typeCodec, t reflect.Type, inProgress map[reflect.Type]*typeCodec) error {
+	// collect the serialized fields
+	var fieldIndices []int
+	var fieldCodecs []*typeCodec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup("simplerpc")
+		if tagged && tag != "-" {
+			return fmt.Errorf("field %s of %s: unsupported simplerpc tag %q", field.Name, t, tag)
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		fieldCodec, err := buildTypeCodec(field.Type, inProgress)
+		if err != nil {
+			return fmt.Errorf("field %s of %s: %w", field.Name, t, err)
+		}
+		fieldIndices = append(fieldIndices, i)
+		fieldCodecs = append(fieldCodecs, fieldCodec)
+	}
+
+	// fields in order
+	codec.marshal = func(buf []byte, v reflect.Value) []byte {
+		for i, fieldCodec := range fieldCodecs {
+			buf = fieldCodec.marshal(buf, v.Field(fieldIndices[i]))
+		}
+		return buf
+	}
+	codec.unmarshal = func(buf []byte, v reflect.Value) []byte {
+		for i, fieldCodec := range fieldCodecs {
+			buf = fieldCodec.unmarshal(buf, v.Field(fieldIndices[i]))
+			if buf == nil {
+				return nil
+			}
+		}
+		return buf
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package simplerpc
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type marshalTestInner struct {
+	Flag  bool
+	Ratio float32
+}
+
+type marshalTestStruct struct {
+	Id       int64
+	Name     string
+	Data     []byte
+	Count    uint8
+	Score    float64
+	Inner    marshalTestInner
+	Tags     []string
+	Attrs    map[string]int32
+	Note     *string
+	Skipped  int64 `simplerpc:"-"`
+	internal int64
+}
+
+type marshalTestNode struct {
+	Value int64
+	Next  *marshalTestNode
+}
+
+func TestMarshal(t *testing.T) {
+	note := "n"
+	v := marshalTestStruct{
+		Id:    -1,
+		Name:  "ab",
+		Data:  []byte{7},
+		Count: 3,
+		Score: 1,
+		Inner: marshalTestInner{
+			Flag:  true,
+			Ratio: 1,
+		},
+		Tags: []string{"x"},
+		Attrs: map[string]int32{
+			"b": 2,
+			"a": 1,
+		},
+		Note:     &note,
+		Skipped:  5,
+		internal: 6,
+	}
+	expected := []byte{
+		0x80,        // id=-1
+		2, 'a', 'b', // name
+		1, 7, // data
+		3,                            // count
+		0x3f, 0xf0, 0, 0, 0, 0, 0, 0, // score=1.0
+		1,                // inner.flag
+		0x3f, 0x80, 0, 0, // inner.ratio=1.0
+		1, 1, 'x', // tags
+		2, 1, 'a', 1, 1, 'b', 2, // attrs in key order
+		1, 1, 'n', // note present
+	}
+
+	// marshal a value and a pointer to it
+	buf, err := Marshal([]byte{9}, v)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte{9}, expected...), buf)
+	buf, err = Marshal([]byte{}, &v)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, buf)
+
+	// nil buffer starts a new one
+	buf, err = Marshal(nil, v)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, buf)
+	buf, err = Marshal(nil, "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{5, 'h', 'e', 'l', 'l', 'o'}, buf)
+
+	// unmarshal, skipped and unexported fields are left alone
+	var result marshalTestStruct
+	newbuf, err := Unmarshal(append(expected, 9), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{9}, newbuf)
+	v.Skipped = 0
+	v.internal = 0
+	assert.Equal(t, v, result)
+
+	// absent pointer
+	v.Note = nil
+	buf, err = Marshal([]byte{}, v)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0), buf[len(buf)-1])
+	result.Note = &note
+	_, err = Unmarshal(buf, &result)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Note)
+}
+
+func TestMarshalRecursive(t *testing.T) {
+	// linked list through an optional pointer
+	v := marshalTestNode{
+		Value: 1,
+		Next: &marshalTestNode{
+			Value: 2,
+		},
+	}
+	buf, err := Marshal([]byte{}, v)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		1, 1, // value=1, next present
+		2, 0, // value=2, next absent
+	}, buf)
+
+	// unmarshal
+	var result marshalTestNode
+	_, err = Unmarshal(buf, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, v, result)
+}
+
+func TestMarshalNaNMapKey(t *testing.T) {
+	// the value of a NaN key is kept, NaN sorts first
+	buf, err := Marshal(nil, map[float64]int64{math.NaN(): 5, 1: 2})
+	assert.Nil(t, err)
+	nanKey := SerializeFloat64([]byte{}, math.NaN())
+	expected := SerializeInteger(SerializeFloat64(SerializeInteger(append([]byte{2}, nanKey...), 5), 1), 2)
+	assert.Equal(t, expected, buf)
+
+	// unmarshal
+	var result map[float64]int64
+	_, err = Unmarshal(buf, &result)
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, int64(2), result[1])
+	for k, v := range result {
+		if math.IsNaN(k) {
+			assert.Equal(t, int64(5), v)
+		}
+	}
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	// unsupported types
+	_, err := Marshal([]byte{}, struct{ C chan int }{})
+	assert.NotNil(t, err)
+	_, err = Marshal([]byte{}, map[[2]int]int{})
+	assert.NotNil(t, err)
+	_, err = Marshal([]byte{}, struct {
+		A int64 `simplerpc:"b"`
+	}{})
+	assert.NotNil(t, err)
+	_, err = Marshal([]byte{}, nil)
+	assert.NotNil(t, err)
+	_, err = Marshal([]byte{}, (*marshalTestNode)(nil))
+	assert.NotNil(t, err)
+
+	// the target must be a non-nil pointer
+	var n int64
+	_, err = Unmarshal([]byte{1}, n)
+	assert.NotNil(t, err)
+	_, err = Unmarshal([]byte{1}, (*int64)(nil))
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	isInvalid := func(buf []byte, v any) {
+		_, err := Unmarshal(buf, v)
+		assert.True(t, errors.Is(err, ErrInvalidFormat))
+	}
+
+	// nil and truncated input
+	isInvalid(nil, new(int64))
+	isInvalid([]byte{1, 1}, new(marshalTestNode))
+
+	// value does not fit into the field
+	isInvalid([]byte{0x20, 0x80}, new(int8))
+	isInvalid([]byte{0x21, 0x00}, new(uint8))
+
+	// list length exceeding the input
+	isInvalid([]byte{0x20, 0x20, 1}, new([]int64))
+
+	// repeated map key
+	isInvalid([]byte{2, 1, 0, 1, 0}, new(map[int64]int64))
+
+	// repeated NaN map key
+	nanKey := SerializeFloat64([]byte{}, math.NaN())
+	isInvalid(append(append(append(append([]byte{2}, nanKey...), 0), nanKey...), 0), new(map[float64]int64))
+}
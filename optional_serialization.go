@@ -0,0 +1,116 @@
+package simplerpc
+
+// Serialize an optional value to the end of buf and return the new buffer. A
+// presence flag is written first as a Bool, then the value with the given
+// function if it is present (not nil).
+func SerializeOptional[T any](buf []byte, v *T, serialize func([]byte, T) []byte) []byte {
+	if v == nil {
+		return SerializeBool(buf, false)
+	}
+	buf = SerializeBool(buf, true)
+	return serialize(buf, *v)
+}
+
+// Deserialize an optional value from the given buf, reading the value with the
+// given function if it is present, and return the remaining bytes and the
+// deserialized value (nil if absent). In case of an error (format error or nil
+// input buffer), nil is returned
+func DeserializeOptional[T any](buf []byte, deserialize func([]byte) ([]byte, T)) ([]byte, *T) {
+	// read presence flag
+	buf, present := DeserializeBool(buf)
+	if buf == nil || !present {
+		return buf, nil
+	}
+
+	// read value
+	var v T
+	buf, v = deserialize(buf)
+	if buf == nil {
+		return nil, nil
+	}
+	return buf, &v
+}
+
+// Serialize an optional integer to the end of buf and return the new buffer
+func SerializeOptionalInteger(buf []byte, v *int64) []byte {
+	return SerializeOptional(buf, v, SerializeInteger)
+}
+
+// Deserialize an optional integer from the given buf and return the remaining
+// bytes and the deserialized value. In case of an error, nil is returned
+func DeserializeOptionalInteger(buf []byte) ([]byte, *int64) {
+	return DeserializeOptional(buf, DeserializeInteger)
+}
+
+// Serialize an optional unsigned integer to the end of buf and return the new
+// buffer
+func SerializeOptionalUint64(buf []byte, v *uint64) []byte {
+	return SerializeOptional(buf, v, SerializeUint64)
+}
+
+// Deserialize an optional unsigned integer from the given buf and return the
+// remaining bytes and the deserialized value. In case of an error, nil is
+// returned
+func DeserializeOptionalUint64(buf []byte) ([]byte, *uint64) {
+	return DeserializeOptional(buf, DeserializeUint64)
+}
+
+// Serialize an optional string to the end of buf and return the new buffer
+func SerializeOptionalString(buf []byte, v *string) []byte {
+	return SerializeOptional(buf, v, SerializeString)
+}
+
+// Deserialize an optional string from the given buf and return the remaining
+// bytes and the deserialized value. In case of an error, nil is returned
+func DeserializeOptionalString(buf []byte) ([]byte, *string) {
+	return DeserializeOptional(buf, DeserializeString)
+}
+
+// Serialize an optional byte slice to the end of buf and return the new buffer
+func SerializeOptionalBlob(buf []byte, v *[]byte) []byte {
+	return SerializeOptional(buf, v, SerializeBlob)
+}
+
+// Deserialize an optional byte slice from the given buf and return the
+// remaining bytes and the deserialized value. In case of an error, nil is
+// returned
+func DeserializeOptionalBlob(buf []byte) ([]byte, *[]byte) {
+	return DeserializeOptional(buf, DeserializeBlob)
+}
+
+// Serialize an optional boolean to the end of buf and return the new buffer
+func SerializeOptionalBool(buf []byte, v *bool) []byte {
+	return SerializeOptional(buf, v, SerializeBool)
+}
+
+// Deserialize an optional boolean from the given buf and return the remaining
+// bytes and the deserialized value. In case of an error, nil is returned
+func DeserializeOptionalBool(buf []byte) ([]byte, *bool) {
+	return DeserializeOptional(buf, DeserializeBool)
+}
+
+// Serialize an optional 64-bit floating point number to the end of buf and
+// return the new buffer
+func SerializeOptionalFloat64(buf []byte, v *float64) []byte {
+	return SerializeOptional(buf, v, SerializeFloat64)
+}
+
+// Deserialize an optional 64-bit floating point number from the given buf and
+// return the remaining bytes and the deserialized value. In case of an error,
+// nil is returned
+func DeserializeOptionalFloat64(buf []byte) ([]byte, *float64) {
+	return DeserializeOptional(buf, DeserializeFloat64)
+}
+
+// Serialize an optional 32-bit floating point number to the end of buf and
+// return the new buffer
+func SerializeOptionalFloat32(buf []byte, v *float32) []byte {
+	return SerializeOptional(buf, v, SerializeFloat32)
+}
+
+// Deserialize an optional 32-bit floating point number from the given buf and
+// return the remaining bytes and the deserialized value. In case of an error,
+// nil is returned
+func DeserializeOptionalFloat32(buf []byte) ([]byte, *float32) {
+	return DeserializeOptional(buf, DeserializeFloat32)
+}
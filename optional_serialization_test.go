@@ -0,0 +1,111 @@
+package simplerpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionalSerialization(t *testing.T) {
+	// absent
+	assert.Equal(t, []byte{0}, SerializeOptionalInteger([]byte{}, nil))
+	newbuf, v := DeserializeOptionalInteger([]byte{0, 9})
+	assert.Equal(t, []byte{9}, newbuf)
+	assert.Nil(t, v)
+
+	// present
+	n := int64(0x20)
+	assert.Equal(t, []byte{1, 0x20, 0x20}, SerializeOptionalInteger([]byte{}, &n))
+	newbuf, v = DeserializeOptionalInteger([]byte{1, 0x20, 0x20, 9})
+	assert.Equal(t, []byte{9}, newbuf)
+	assert.Equal(t, &n, v)
+
+	// present zero value differs from absent
+	zero := int64(0)
+	assert.Equal(t, []byte{1, 0}, SerializeOptionalInteger([]byte{}, &zero))
+
+	// invalid: nil input
+	newbuf, _ = DeserializeOptionalInteger(nil)
+	assert.Nil(t, newbuf)
+
+	// invalid: bad presence flag
+	newbuf, _ = DeserializeOptionalInteger([]byte{2, 0})
+	assert.Nil(t, newbuf)
+
+	// invalid: value missing
+	newbuf, _ = DeserializeOptionalInteger([]byte{1})
+	assert.Nil(t, newbuf)
+}
+
+func TestOptionalPrimitivesRoundTrip(t *testing.T) {
+	// round-trip a present and an absent value with each helper
+	roundTrip := func(serialized []byte, deserialize func([]byte) []byte) {
+		assert.Equal(t, []byte{}, deserialize(serialized))
+	}
+	u := uint64(1 << 63)
+	roundTrip(SerializeOptionalUint64([]byte{}, &u), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalUint64(buf)
+		assert.Equal(t, &u, v)
+		return buf
+	})
+	s := "hello"
+	roundTrip(SerializeOptionalString([]byte{}, &s), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalString(buf)
+		assert.Equal(t, &s, v)
+		return buf
+	})
+	roundTrip(SerializeOptionalString([]byte{}, nil), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalString(buf)
+		assert.Nil(t, v)
+		return buf
+	})
+	blob := []byte{1, 2, 3}
+	roundTrip(SerializeOptionalBlob([]byte{}, &blob), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalBlob(buf)
+		assert.Equal(t, &blob, v)
+		return buf
+	})
+	b := false
+	roundTrip(SerializeOptionalBool([]byte{}, &b), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalBool(buf)
+		assert.Equal(t, &b, v)
+		return buf
+	})
+	f64 := 2.5
+	roundTrip(SerializeOptionalFloat64([]byte{}, &f64), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalFloat64(buf)
+		assert.Equal(t, &f64, v)
+		return buf
+	})
+	f32 := float32(-0.5)
+	roundTrip(SerializeOptionalFloat32([]byte{}, &f32), func(buf []byte) []byte {
+		buf, v := DeserializeOptionalFloat32(buf)
+		assert.Equal(t, &f32, v)
+		return buf
+	})
+}
+
+func TestOptionalWithCustomSerializer(t *testing.T) {
+	// optional list of integers
+	list := []int64{1, 2}
+	serializeList := func(buf []byte, list []int64) []byte {
+		return SerializeList(buf, list, SerializeInteger)
+	}
+	deserializeList := func(buf []byte) ([]byte, []int64) {
+		return DeserializeList(buf, DeserializeInteger)
+	}
+	buf := SerializeOptional([]byte{}, &list, serializeList)
+	assert.Equal(t, []byte{1, 2, 1, 2}, buf)
+	newbuf, v := DeserializeOptional(buf, deserializeList)
+	assert.Equal(t, []byte{}, newbuf)
+	assert.Equal(t, &list, v)
+
+	// list of optional strings
+	s := "x"
+	optionals := []*string{&s, nil}
+	buf = SerializeList([]byte{}, optionals, SerializeOptionalString)
+	assert.Equal(t, []byte{2, 1, 1, 'x', 0}, buf)
+	newbuf, optionals2 := DeserializeList(buf, DeserializeOptionalString)
+	assert.Equal(t, []byte{}, newbuf)
+	assert.Equal(t, optionals, optionals2)
+}
@@ -0,0 +1,159 @@
+package simplerpc
+
+import "log/slog"
+
+// Function called when a service function panics, with the ids of the called
+// function, the value passed to panic and the stack trace of the goroutine. It
+// is also called when the health check or the description of a service panics,
+// with the id of the service and ServerFunctionHealth or
+// ServerFunctionDescribeService.
+type PanicHandler func(serviceId, functionId int64, value any, stack []byte)
+
+// Option for configuring a server in NewServerWithOptions
+type ServerOption func(srv *Server)
+
+// Set the function to call when a service function panics. The panic is
+// recovered and the caller gets an error response regardless of this option.
+func WithPanicHandler(handler PanicHandler) ServerOption {
+	return func(srv *Server) {
+		srv.panicHandler = handler
+	}
+}
+
+// Set the maximum size of a request in bytes. Larger requests are rejected with
+// the ErrorCodeRequestTooLarge code, and ServeTCP closes the connection when a
+// larger frame arrives instead of reading it. Zero means no limit.
+func WithMaxRequestSize(size int) ServerOption {
+	return func(srv *Server) {
+		srv.maxRequestSize = size
+	}
+}
+
+// Set the maximum number of service function calls running at the same time.
+// Calls beyond this limit wait in the queue (see WithMaxQueuedRequests), or are
+// rejected with the ErrorCodeOverloaded code if the queue is full. The
+// functions of the server itself (service id 0) are not limited. Zero means no
+// limit.
+func WithMaxConcurrentRequests(count int) ServerOption {
+	return func(srv *Server) {
+		if count > 0 {
+			srv.executor.global = make(chan struct{}, count)
+		} else {
+			srv.executor.global = nil
+		}
+	}
+}
+
+// Set the maximum number of calls of the given service running at the same
+// time, in addition to the global limit. Calls beyond this limit are queued or
+// rejected like the ones beyond the global limit. Zero means no limit.
+func WithMaxConcurrentRequestsPerService(serviceId int64, count int) ServerOption {
+	return func(srv *Server) {
+		if srv.executor.services == nil {
+			srv.executor.services = map[int64]chan struct{}{}
+		}
+		if count > 0 {
+			srv.executor.services[serviceId] = make(chan struct{}, count)
+		} else {
+			delete(srv.executor.services, serviceId)
+		}
+	}
+}
+
+// Set the number of service function calls that can wait for a free slot when
+// the concurrency limits are reached. Calls arriving when the queue is full are
+// rejected with the ErrorCodeOverloaded code. Queued calls can be cancelled and
+// time out like running ones. The default is zero, rejecting calls beyond the
+// limits immediately.
+func WithMaxQueuedRequests(count int) ServerOption {
+	return func(srv *Server) {
+		srv.executor.maxQueued = int64(max(count, 0))
+	}
+}
+
+// Set the logger of the server. Panics of service functions and transport
+// errors are logged to it. By default the server does not log anything.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(srv *Server) {
+		srv.logger = logger
+	}
+}
+
+// Disable the given functions of the server itself (service id 0). Calling a
+// disabled function fails with the ErrorCodeUnknownFunction code.
+func WithDisabledServerFunctions(functionIds ...int64) ServerOption {
+	return func(srv *Server) {
+		if srv.disabledServerFunctions == nil {
+			srv.disabledServerFunctions = map[int64]bool{}
+		}
+		for _, functionId := range functionIds {
+			srv.disabledServerFunctions[functionId] = true
+		}
+	}
+}
+
+// Set the number of request ids the server remembers for cancellation. When a
+// cancel request arrives before the request it cancels, the id is remembered
+// and the request is rejected when it arrives. The ids of the finished requests
+// are remembered too, so cancelling them is reported as unknown instead of
+// pending. Zero disables remembering. The default is 1024.
+func WithCancelWindow(size int) ServerOption {
+	return func(srv *Server) {
+		srv.cancelWindow = max(size, 0)
+	}
+}
+
+// Reject requests whose header (request id, service id, function id and
+// timeout) contains integers not in their canonical form. Such requests are
+// dropped without a response, like requests with a malformed header.
+func WithStrictHeaders(strict bool) ServerOption {
+	return func(srv *Server) {
+		srv.strictHeaders = strict
+	}
+}
+
+// Read the request frames of ServeTCP into buffers taken from the buffer pool,
+// and write the responses into pooled buffers as well. The buffers are put back
+// once the response is written. This saves two allocations per request, but
+// the blobs deserialized from a request refer to its frame, so service
+// functions and interceptors must not keep them after they return, nor the
+// response bytes returned by next or CallFunction. The default is false, so
+// every request frame and response is a new buffer.
+func WithPooledRequestBuffers(enabled bool) ServerOption {
+	return func(srv *Server) {
+		srv.pooledRequestBuffers = enabled
+	}
+}
+
+// Limit the calls of the given service to rate calls per second on average,
+// allowing bursts of burst calls. Calls beyond the limit are rejected with the
+// ErrorCodeRateLimited code and the time after which a call would be allowed.
+// Zero or negative rate means no limit.
+func WithServiceRateLimit(serviceId int64, rate float64, burst int) ServerOption {
+	return func(srv *Server) {
+		if srv.rateLimiter.services == nil {
+			srv.rateLimiter.services = map[int64]*tokenBucket{}
+		}
+		if rate > 0 {
+			srv.rateLimiter.services[serviceId] = newTokenBucket(rate, burst, srv.rateLimiter.now())
+		} else {
+			delete(srv.rateLimiter.services, serviceId)
+		}
+	}
+}
+
+// Limit the calls of the given function like WithServiceRateLimit. A call has to
+// be within the limit of its service as well.
+func WithFunctionRateLimit(serviceId, functionId int64, rate float64, burst int) ServerOption {
+	return func(srv *Server) {
+		if srv.rateLimiter.functions == nil {
+			srv.rateLimiter.functions = map[functionKey]*tokenBucket{}
+		}
+		key := functionKey{serviceId, functionId}
+		if rate > 0 {
+			srv.rateLimiter.functions[key] = newTokenBucket(rate, burst, srv.rateLimiter.now())
+		} else {
+			delete(srv.rateLimiter.functions, key)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package simplerpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPanicHandler(t *testing.T) {
+	// create server with a panic handler
+	var panicValue any
+	var panicStack []byte
+	var panicServiceId, panicFunctionId int64
+	server, err := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 3,
+		},
+	}, WithPanicHandler(func(serviceId, functionId int64, value any, stack []byte) {
+		panicServiceId = serviceId
+		panicFunctionId = functionId
+		panicValue = value
+		panicStack = stack
+	}))
+	assert.Nil(t, err)
+
+	// call the panicking function
+	req := []byte{
+		0,                 // request id 0, no response expected
+		3,                 // service id
+		id_testfunc_panic, // function id
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Nil(t, resp)
+
+	// the handler must have been called
+	assert.EqualValues(t, 3, panicServiceId)
+	assert.EqualValues(t, id_testfunc_panic, panicFunctionId)
+	assert.Equal(t, "test panic", panicValue)
+	assert.Contains(t, string(panicStack), "CallFunction")
+}
+
+func TestWithMaxRequestSize(t *testing.T) {
+	// create server with a 5 byte limit
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithMaxRequestSize(5))
+
+	// request within the limit
+	req := []byte{
+		1,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1, // request id
+		1, // success
+		5, // result
+	}, resp)
+
+	// request over the limit
+	req = []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		0x20, 50, 3,          // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeRequestTooLarge, "request size 6 exceeds the limit 5")), resp)
+}
+
+func TestWithMaxRequestSizeClosesConnection(t *testing.T) {
+	// create server with a 5 byte limit
+	server, _ := NewServerWithOptions([]ServerService{}, WithMaxRequestSize(5))
+	addr, stop := startTestTCPServer(t, server)
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// the connection is closed when a larger frame arrives
+	assert.Nil(t, writeFrame(conn, []byte{1, 0, 0, 0, 0, 0}))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = readFrame(bufio.NewReader(conn))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, stop())
+}
+
+func TestWithMaxConcurrentRequests(t *testing.T) {
+	// create server allowing 1 concurrent call
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithMaxConcurrentRequests(1))
+
+	// start a slow call
+	done := make(chan []byte)
+	go func() {
+		req := []byte{
+			1,                         // request id
+			1,                         // service id
+			id_testfunc_wait_a_little, // function id
+		}
+		done <- server.ProcessRequest(context.Background(), req, nil)
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// another call is rejected meanwhile
+	req := []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeOverloaded, "too many concurrent requests")), resp)
+
+	// server functions are not limited
+	req = []byte{
+		3, // request id
+		0, // service id
+		0, // function id: get services
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{3, 1, 1, 1, 0}, resp)
+
+	// the call succeeds once the slow one finished
+	assert.Equal(t, []byte{1, 1}, <-done)
+	req = []byte{
+		4,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{4, 1, 5}, resp)
+}
+
+func TestWithLogger(t *testing.T) {
+	// create server logging to a buffer
+	var buf bytes.Buffer
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	// panics are logged
+	req := []byte{
+		1,                 // request id
+		1,                 // service id
+		id_testfunc_panic, // function id
+	}
+	server.ProcessRequest(context.Background(), req, nil)
+	assert.Contains(t, buf.String(), "service function panicked")
+	assert.Contains(t, buf.String(), "value=\"test panic\"")
+}
+
+func TestWithDisabledServerFunctions(t *testing.T) {
+	// create server with echo disabled
+	server, _ := NewServerWithOptions([]ServerService{}, WithDisabledServerFunctions(ServerFunctionEcho))
+
+	// echo fails
+	req := []byte{
+		1, // request id
+		0, // service id
+		2, // function id: echo
+		0, // wait time
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeUnknownFunction, "server function 2 is disabled")), resp)
+
+	// get services still works
+	req = []byte{
+		2, // request id
+		0, // service id
+		0, // function id: get services
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{2, 1, 0}, resp)
+}
+
+func TestWithStrictHeaders(t *testing.T) {
+	// create servers with and without strict headers
+	services := []ServerService{
+		&testService{
+			id: 1,
+		},
+	}
+	server, _ := NewServer(services)
+	strictServer, _ := NewServerWithOptions(services, WithStrictHeaders(true))
+
+	// service id=1 written in mode 01
+	req := []byte{
+		1,          // request id
+		0x20, 0x01, // service id=1, non-canonical
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	assert.Equal(t, []byte{1, 1, 5}, server.ProcessRequest(context.Background(), req, nil))
+	assert.Nil(t, strictServer.ProcessRequest(context.Background(), req, nil))
+
+	// non-canonical timeout is rejected as well
+	req = []byte{
+		2,                    // request id
+		0x81,                 // service id=1 with timeout
+		id_testfunc_add_nums, // function id
+		0x60, 0x00,           // timeout=0, non-canonical
+		2, 3, // nums
+	}
+	assert.Equal(t, []byte{2, 1, 5}, server.ProcessRequest(context.Background(), req, nil))
+	assert.Nil(t, strictServer.ProcessRequest(context.Background(), req, nil))
+
+	// canonical header is accepted
+	req = []byte{
+		3,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	assert.Equal(t, []byte{3, 1, 5}, strictServer.ProcessRequest(context.Background(), req, nil))
+}
+
+// Service keeping the blob of its first call and returning it on every call
+type retainingService struct {
+	first []byte
+}
+
+func (srv *retainingService) GetServiceId() int64 {
+	return 1
+}
+func (srv *retainingService) GetRevision() string {
+	return ""
+}
+func (srv *retainingService) CallFunction(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) []byte {
+	_, blob := DeserializeBlob(requestBytes)
+	if srv.first == nil {
+		srv.first = blob
+	}
+	return SerializeBlob(respBytes, srv.first)
+}
+
+func TestWithPooledRequestBuffers(t *testing.T) {
+	for _, pooled := range []bool{false, true} {
+		// create server and client
+		service := &retainingService{}
+		server, _ := NewServerWithOptions([]ServerService{service}, WithPooledRequestBuffers(pooled))
+		addr, stop := startTestTCPServer(t, server)
+		client, err := DialTCP(context.Background(), addr)
+		assert.Nil(t, err)
+
+		// both calls get the blob of the first one
+		resp, err := client.Call(context.Background(), 1, 1, SerializeBlob([]byte{}, []byte("first-value")))
+		assert.Nil(t, err)
+		assert.Equal(t, SerializeBlob([]byte{}, []byte("first-value")), resp)
+		resp, err = client.Call(context.Background(), 1, 1, SerializeBlob([]byte{}, []byte("SECOND-VALUE")))
+		assert.Nil(t, err)
+		if !pooled {
+			// the kept blob is not overwritten by the second request by default
+			assert.Equal(t, SerializeBlob([]byte{}, []byte("first-value")), resp)
+		}
+
+		// done
+		client.Close()
+		assert.Nil(t, stop())
+	}
+}
+
+func TestResponseBuffersNotPooledByDefault(t *testing.T) {
+	// create server with an interceptor keeping the first result it sees
+	var first []byte
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithInterceptors(func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error) {
+		out, err := next(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+		if first == nil {
+			first = out[len(respBytes):]
+		}
+		return out, err
+	}))
+	addr, stop := startTestTCPServer(t, server)
+	client, err := DialTCP(context.Background(), addr)
+	assert.Nil(t, err)
+
+	// the kept result is not overwritten by the second call
+	resp, err := client.Call(context.Background(), 1, id_testfunc_add_nums, []byte{2, 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{5}, resp)
+	resp, err = client.Call(context.Background(), 1, id_testfunc_add_nums, []byte{1, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, resp)
+	assert.Equal(t, []byte{5}, first)
+
+	// done
+	client.Close()
+	assert.Nil(t, stop())
+}
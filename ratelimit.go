@@ -0,0 +1,103 @@
+package simplerpc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Token bucket allowing rate calls per second on average and burst calls at once
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(max(burst, 1)),
+		tokens: float64(max(burst, 1)),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Return the time until the bucket has a token, zero if it has one now. A wait
+// too long for a duration is clamped to the largest one.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	wait := math.Ceil((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(wait)
+}
+
+type functionKey struct {
+	serviceId  int64
+	functionId int64
+}
+
+// Rate limits of the services and functions, a call is allowed if it gets a
+// token from both the bucket of its service and the bucket of its function
+type rateLimiter struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	services  map[int64]*tokenBucket
+	functions map[functionKey]*tokenBucket
+}
+
+func (l *rateLimiter) allow(serviceId, functionId int64) error {
+	// nothing to do without limits
+	if len(l.services) == 0 && len(l.functions) == 0 {
+		return nil
+	}
+
+	// lock mutex
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// find the buckets of the call
+	now := l.now()
+	serviceBucket := l.services[serviceId]
+	functionBucket := l.functions[functionKey{serviceId, functionId}]
+
+	// reject the call if any of them is empty
+	var err *Error
+	if serviceBucket != nil {
+		serviceBucket.refill(now)
+		if wait := serviceBucket.wait(); wait > 0 {
+			err = NewError(ErrorCodeRateLimited, "rate limit of service %d exceeded", serviceId)
+			err.RetryAfter = wait
+		}
+	}
+	if functionBucket != nil {
+		functionBucket.refill(now)
+		if wait := functionBucket.wait(); wait > 0 && (err == nil || wait > err.RetryAfter) {
+			err = NewError(ErrorCodeRateLimited, "rate limit of function %d of service %d exceeded", functionId, serviceId)
+			err.RetryAfter = wait
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// take the tokens
+	if serviceBucket != nil {
+		serviceBucket.tokens--
+	}
+	if functionBucket != nil {
+		functionBucket.tokens--
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package simplerpc
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	// create server with a fake clock, limiting service 1 to 1 call per second
+	// with bursts of 2, and its add function to 1 call per 2 seconds
+	now := time.Unix(1000, 0)
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	server.rateLimiter.now = func() time.Time {
+		return now
+	}
+	for _, opt := range []ServerOption{
+		WithServiceRateLimit(1, 1, 2),
+		WithFunctionRateLimit(1, id_testfunc_add_nums, 0.5, 1),
+	} {
+		opt(&server)
+	}
+	call := func(requestId byte, functionId byte) []byte {
+		req := []byte{
+			requestId,  // request id
+			1,          // service id
+			functionId, // function id
+			2, 3,       // nums
+		}
+		return server.ProcessRequest(context.Background(), req, nil)
+	}
+	rateLimited := func(requestId byte, retryAfter time.Duration, format string, args ...any) []byte {
+		e := NewError(ErrorCodeRateLimited, format, args...)
+		e.RetryAfter = retryAfter
+		return SerializeError([]byte{requestId, 2}, e)
+	}
+
+	// the add function is limited to a single call
+	assert.Equal(t, []byte{1, 1, 5}, call(1, id_testfunc_add_nums))
+	assert.Equal(t, rateLimited(2, time.Second*2, "rate limit of function %d of service 1 exceeded", id_testfunc_add_nums), call(2, id_testfunc_add_nums))
+
+	// the service has 1 more token in the burst
+	assert.Equal(t, []byte{3, 1, 0}, call(3, id_testfunc_append_string))
+	assert.Equal(t, rateLimited(4, time.Second, "rate limit of service 1 exceeded"), call(4, id_testfunc_append_string))
+
+	// half a second later, both buckets are still empty, the longer wait is reported
+	now = now.Add(time.Millisecond * 500)
+	assert.Equal(t, rateLimited(5, time.Millisecond*1500, "rate limit of function %d of service 1 exceeded", id_testfunc_add_nums), call(5, id_testfunc_add_nums))
+	assert.Equal(t, rateLimited(6, time.Millisecond*500, "rate limit of service 1 exceeded"), call(6, id_testfunc_append_string))
+
+	// the service bucket refills first
+	now = now.Add(time.Millisecond * 500)
+	assert.Equal(t, []byte{7, 1, 0}, call(7, id_testfunc_append_string))
+
+	// a rejected call does not take a token from the other bucket, so the add
+	// function succeeds once its own bucket refilled
+	now = now.Add(time.Second * 2)
+	assert.Equal(t, []byte{8, 1, 5}, call(8, id_testfunc_add_nums))
+
+	// server functions are not limited
+	for i := byte(0); i < 5; i++ {
+		resp := server.ProcessRequest(context.Background(), []byte{9 + i, 0, 0}, nil)
+		assert.Equal(t, []byte{9 + i, 1, 1, 1, 0}, resp)
+	}
+}
+
+func TestRateLimitRemoved(t *testing.T) {
+	// a zero rate removes the limit
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithServiceRateLimit(1, 1, 1), WithServiceRateLimit(1, 0, 0))
+	for i := byte(1); i <= 5; i++ {
+		resp := server.ProcessRequest(context.Background(), []byte{i, 1, id_testfunc_add_nums, 2, 3}, nil)
+		assert.Equal(t, []byte{i, 1, 5}, resp)
+	}
+}
+
+func TestRateLimitVerySlowRate(t *testing.T) {
+	// a wait too long for a duration still rejects the call
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{
+			id: 1,
+		},
+	}, WithServiceRateLimit(1, 1e-12, 1))
+	resp := server.ProcessRequest(context.Background(), []byte{1, 1, id_testfunc_add_nums, 2, 3}, nil)
+	assert.Equal(t, []byte{1, 1, 5}, resp)
+	e := NewError(ErrorCodeRateLimited, "rate limit of service 1 exceeded")
+	e.RetryAfter = time.Duration(math.MaxInt64)
+	resp = server.ProcessRequest(context.Background(), []byte{2, 1, id_testfunc_add_nums, 2, 3}, nil)
+	assert.Equal(t, SerializeError([]byte{2, 2}, e), resp)
+}
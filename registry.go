@@ -0,0 +1,105 @@
+package simplerpc
+
+import (
+	"fmt"
+	"sync"
+)
+
+type serviceRegistry struct {
+	mu       sync.RWMutex
+	services []ServerService
+	index    map[int64]ServerService
+}
+
+func (r *serviceRegistry) add(service ServerService) error {
+	// check if id is valid
+	id := service.GetServiceId()
+	if id <= 0 {
+		return fmt.Errorf("service has invalid id: %d", id)
+	}
+
+	// lock mutex
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// check if id is not repeating
+	if _, found := r.index[id]; found {
+		return fmt.Errorf("service with id %d is already registered", id)
+	}
+
+	// add service
+	r.services = append(r.services, service)
+	r.index[id] = service
+	return nil
+}
+
+func (r *serviceRegistry) remove(id int64) bool {
+	// lock mutex
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// find service
+	service, found := r.index[id]
+	if !found {
+		return false
+	}
+
+	// remove it, keeping the order of the rest
+	delete(r.index, id)
+	for i := range r.services {
+		if r.services[i] == service {
+			r.services = append(r.services[:i:i], r.services[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (r *serviceRegistry) get(id int64) (ServerService, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	service, found := r.index[id]
+	return service, found
+}
+
+// Get the registered services. The returned slice is never modified, as
+// removing a service always creates a new slice.
+func (r *serviceRegistry) list() []ServerService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.services
+}
+
+// Register a service on a running server. The service can be called as soon as
+// this function returns. Return error if the service has invalid id or a
+// service with the same id is already registered.
+func (srv Server) RegisterService(service ServerService) error {
+	err := srv.registry.add(service)
+	if err != nil {
+		return fmt.Errorf("could not register service: %w", err)
+	}
+	return nil
+}
+
+// Unregister the service with the given id from a running server. Requests
+// arriving afterwards, as well as the ones not having reached the service
+// function yet (e.g. still running an interceptor), fail with the
+// ErrorCodeUnknownService code, while the calls already running on the service
+// are left to finish. Return error if there is no service with the given id.
+func (srv Server) UnregisterService(id int64) error {
+	if !srv.registry.remove(id) {
+		return fmt.Errorf("could not unregister service: no service with id %d", id)
+	}
+	return nil
+}
+
+// Unregister the service with the given id like UnregisterService, and cancel
+// the calls already running on the service as well
+func (srv Server) UnregisterServiceAndCancel(id int64) error {
+	err := srv.UnregisterService(id)
+	if err != nil {
+		return err
+	}
+	srv.cancellers.cancelService(id)
+	return nil
+}
@@ -0,0 +1,204 @@
+package simplerpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterService(t *testing.T) {
+	// create server with a service
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id:       1,
+			revision: "a",
+		},
+	})
+
+	// register another one
+	err := server.RegisterService(&testService{
+		id:       2,
+		revision: "b",
+	})
+	assert.Nil(t, err)
+
+	// it is listed by get services
+	req := []byte{
+		1, // request id
+		0, // service id
+		0, // function id: get services
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1,      // request id
+		1,      // success
+		2,      // 2 services
+		1,      // first service, id
+		1, 'a', // first service, revision
+		2,      // second service, id
+		1, 'b', // second service, revision
+	}, resp)
+
+	// and it can be called
+	req = []byte{
+		2,                    // request id
+		2,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{2, 1, 5}, resp)
+
+	// invalid or repeating ids cannot be registered
+	assert.NotNil(t, server.RegisterService(&testService{id: 0}))
+	assert.NotNil(t, server.RegisterService(&testService{id: -1}))
+	assert.NotNil(t, server.RegisterService(&testService{id: 2}))
+}
+
+func TestUnregisterService(t *testing.T) {
+	// create server with 3 services
+	server, _ := NewServer([]ServerService{
+		&testService{id: 1},
+		&testService{id: 2},
+		&testService{id: 3},
+	})
+
+	// unregister the middle one
+	assert.Nil(t, server.UnregisterService(2))
+	assert.NotNil(t, server.UnregisterService(2))
+
+	// it is not listed by get services
+	req := []byte{
+		1, // request id
+		0, // service id
+		0, // function id: get services
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1,    // request id
+		1,    // success
+		2,    // 2 services
+		1, 0, // first service
+		3, 0, // second service
+	}, resp)
+
+	// and it cannot be called
+	req = []byte{
+		2,                    // request id
+		2,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeUnknownService, "no service with id 2")), resp)
+
+	// the id can be registered again
+	assert.Nil(t, server.RegisterService(&testService{id: 2}))
+}
+
+func TestUnregisterServiceAndCancel(t *testing.T) {
+	// create server with 2 services
+	server, _ := NewServer([]ServerService{
+		&testService{id: 1},
+		&testService{id: 2},
+	})
+
+	// start a slow call on both
+	call := func(requestId, serviceId int64) chan []byte {
+		done := make(chan []byte)
+		go func() {
+			req := []byte{
+				byte(requestId),           // request id
+				byte(serviceId),           // service id
+				id_testfunc_wait_a_little, // function id
+			}
+			done <- server.ProcessRequest(context.Background(), req, nil)
+		}()
+		return done
+	}
+	done1 := call(1, 1)
+	done2 := call(2, 2)
+	time.Sleep(time.Millisecond * 50)
+
+	// unregister the first one, its call is cancelled
+	assert.Nil(t, server.UnregisterServiceAndCancel(1))
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), <-done1)
+	assert.Equal(t, []byte{2, 1}, <-done2)
+
+	// unknown id
+	assert.NotNil(t, server.UnregisterServiceAndCancel(1))
+}
+
+func TestUnregisterServiceDuringInterceptor(t *testing.T) {
+	// create server with an interceptor waiting until the service is unregistered
+	unregistered := make(chan struct{})
+	entered := make(chan struct{})
+	server, _ := NewServerWithOptions([]ServerService{
+		&testService{id: 1},
+	}, WithInterceptors(func(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte, next ServerCallFunc) ([]byte, error) {
+		close(entered)
+		<-unregistered
+		return next(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+	}))
+
+	// start a call, and unregister the service while it is in the interceptor
+	done := make(chan []byte)
+	go func() {
+		req := []byte{
+			1,                    // request id
+			1,                    // service id
+			id_testfunc_add_nums, // function id
+			2, 3,                 // nums
+		}
+		done <- server.ProcessRequest(context.Background(), req, nil)
+	}()
+	<-entered
+	assert.Nil(t, server.UnregisterServiceAndCancel(1))
+	close(unregistered)
+
+	// the call does not reach the service
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeUnknownService, "no service with id 1")), <-done)
+}
+
+func TestRegisterServiceConcurrently(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+
+	// register and unregister services while calling them
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				server.RegisterService(&testService{id: int64(i)})
+				req := []byte{
+					1,       // request id
+					byte(i), // service id
+					0,       // function id
+				}
+				server.ProcessRequest(context.Background(), req, nil)
+				req = []byte{
+					1, // request id
+					0, // service id
+					0, // function id: get services
+				}
+				server.ProcessRequest(context.Background(), req, nil)
+				server.UnregisterService(int64(i))
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -3,7 +3,9 @@ package simplerpc
 import (
 	"context"
 	"fmt"
-	"sync"
+	"log/slog"
+	"math"
+	"runtime/debug"
 	"time"
 )
 
@@ -15,220 +17,258 @@ type ServerService interface {
 	CallFunction(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) []byte
 }
 
-type canceller struct {
-	mu      sync.Mutex
-	cancels map[int64]context.CancelFunc
-}
-
-func (c *canceller) addRequest(ctx context.Context, requestId int64) context.Context {
-	// create context with cancellation
-	ctx, cancel := context.WithCancel(ctx)
-
-	// lock mutex
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// add cancellation
-	c.cancels[requestId] = cancel
-
-	// done
-	return ctx
-}
-
-func (c *canceller) requestFinished(requestId int64) (cancelled bool) {
-	// lock mutex
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// find cancel
-	_, found := c.cancels[requestId]
-
-	// if found, delete it
-	if found {
-		delete(c.cancels, requestId)
-	}
-
-	// return cancelled if not found
-	return !found
-}
-
-func (c *canceller) cancelRequest(requestId int64) (found bool) {
-	// lock mutex
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// find cancel
-	cancel, found := c.cancels[requestId]
-
-	// if found, delete it and cancel
-	if found {
-		delete(c.cancels, requestId)
-		cancel()
-	}
-
-	// done
-	return found
+// Optional interface a service can implement to report why a call failed. If a
+// service implements it, CallFunctionWithError is called instead of
+// CallFunction. The returned error is sent to the caller: an *Error is sent as
+// is, any other error is sent as a handler error with its message. Application
+// errors should use the codes from ErrorCodeApplication up.
+type ServerServiceWithError interface {
+	ServerService
+	CallFunctionWithError(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error)
 }
 
 // Server type wrapping the services
 type Server struct {
-	canceller *canceller
-	services  []ServerService
+	canceller               *canceller
+	cancellers              *cancellerSet
+	cancelWindow            int
+	startTime               time.Time
+	registry                *serviceRegistry
+	panicHandler            PanicHandler
+	interceptors            []ServerInterceptor
+	maxRequestSize          int
+	executor                *executor
+	rateLimiter             *rateLimiter
+	logger                  *slog.Logger
+	disabledServerFunctions map[int64]bool
+	strictHeaders           bool
+	pooledRequestBuffers    bool
 }
 
 // Create a new server with the given services. Return error if any service has invalid id
 func NewServer(services []ServerService) (srv Server, err error) {
-	// validate services
-	for curr := range services {
-		// check if id is valid
-		id := services[curr].GetServiceId()
-		if id <= 0 {
-			err = fmt.Errorf("could not create server: service at index %d has invalid id", id)
+	return NewServerWithOptions(services)
+}
+
+// Create a new server with the given services and options. Return error if any
+// service has invalid id
+func NewServerWithOptions(services []ServerService, opts ...ServerOption) (srv Server, err error) {
+	// register services
+	srv.registry = &serviceRegistry{
+		index: make(map[int64]ServerService, len(services)),
+	}
+	for i, service := range services {
+		err = srv.registry.add(service)
+		if err != nil {
+			err = fmt.Errorf("could not create server: service at index %d: %w", i, err)
 			return
 		}
+	}
 
-		// check if id is not repeating
-		for i := 0; i < curr; i++ {
-			if id == services[i].GetServiceId() {
-				err = fmt.Errorf("could not create server: services at indices %d and %d has the same id: %d", i, curr, id)
-				return
-			}
-		}
+	// apply options
+	srv.startTime = time.Now()
+	srv.executor = &executor{}
+	srv.rateLimiter = &rateLimiter{
+		now: time.Now,
+	}
+	srv.cancelWindow = defaultCancelWindow
+	for _, opt := range opts {
+		opt(&srv)
 	}
 
 	// return server instance and no error
-	srv.canceller = &canceller{
-		cancels: map[int64]context.CancelFunc{},
+	srv.canceller = newCanceller(srv.cancelWindow)
+	srv.cancellers = &cancellerSet{
+		set: map[*canceller]struct{}{},
 	}
-	srv.services = services
+	srv.cancellers.add(srv.canceller)
 	return
 }
 
-func (srv Server) handleServerRequestGetServices(respBytes []byte) []byte {
-	// write array length
-	respBytes = SerializeInteger(respBytes, int64(len(srv.services)))
-
-	// write each elements
-	for _, service := range srv.services {
-		respBytes = SerializeInteger(respBytes, service.GetServiceId())
-		respBytes = SerializeString(respBytes, service.GetRevision())
+// Convert milliseconds to a duration, clamping values too large for a duration
+// to the largest one, which is no limit in practice
+func millisecondsToDuration(ms int64) time.Duration {
+	if ms >= math.MaxInt64/int64(time.Millisecond) {
+		return time.Duration(math.MaxInt64)
 	}
+	return time.Duration(int64(time.Millisecond) * ms)
+}
 
-	// done
-	return respBytes
+func (srv Server) log(level slog.Level, msg string, args ...any) {
+	if srv.logger != nil {
+		srv.logger.Log(context.Background(), level, msg, args...)
+	}
 }
 
-func (srv Server) handleServerRequestCancel(requestBytes []byte) {
-	// read request id to cancel
-	requestBytes, requestIdToCancel := DeserializeInteger(requestBytes)
-	if requestBytes != nil {
-		srv.canceller.cancelRequest(requestIdToCancel)
+// Log a recovered panic and pass it to the panic handler, must be called from
+// the deferred function recovering it so the stack is the one of the panic
+func (srv Server) reportPanic(msg string, serviceId, functionId int64, value any) {
+	stack := debug.Stack()
+	srv.log(slog.LevelError, msg, "serviceId", serviceId, "functionId", functionId, "value", value, "stack", string(stack))
+	if srv.panicHandler != nil {
+		srv.panicHandler(serviceId, functionId, value, stack)
 	}
 }
 
-func (srv Server) handleServerRequestEcho(requestBytes []byte, respBytes []byte) []byte {
-	// read wait time
-	requestBytes, wait_ms := DeserializeInteger(requestBytes)
+func (srv Server) invokeService(ctx context.Context, service ServerService, functionId int64, requestBytes []byte, respBytes []byte) (resp []byte, err error) {
+	// recover panics of the function
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		srv.reportPanic("service function panicked", service.GetServiceId(), functionId, value)
+		// the panic value may contain internal details, so only the logger and
+		// the panic handler get it
+		resp, err = nil, NewError(ErrorCodePanic, "")
+	}()
 
-	// wait that much time
-	if wait_ms > 0 {
-		time.Sleep(time.Duration(int64(time.Millisecond) * wait_ms))
+	// call the function
+	if serviceWithError, ok := service.(ServerServiceWithError); ok {
+		return serviceWithError.CallFunctionWithError(ctx, functionId, requestBytes, respBytes)
 	}
-
-	// copy request bytes
-	return append(respBytes, requestBytes...)
+	return service.CallFunction(ctx, functionId, requestBytes, respBytes), nil
 }
 
-func (srv Server) callFunctionOnServer(functionId int64, requestBytes []byte, respBytes []byte) []byte {
-	// get services
-	if functionId == 0 {
-		return srv.handleServerRequestGetServices(respBytes)
+func (srv Server) callFunctionOnService(ctx context.Context, service ServerService, requestId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// reject the call if it exceeds a rate limit
+	err := srv.rateLimiter.allow(service.GetServiceId(), functionId)
+	if err != nil {
+		return nil, err
 	}
 
-	// cancel request
-	if functionId == 1 {
-		srv.handleServerRequestCancel(requestBytes)
-		return respBytes
+	// set up cancellation, reject the request if it was cancelled before it arrived
+	ctx, ok := srv.canceller.addRequest(ctx, requestId, service.GetServiceId())
+	if !ok {
+		return nil, NewError(ErrorCodeCancelled, "request %d was cancelled", requestId)
 	}
 
-	// echo
-	if functionId == 2 {
-		return srv.handleServerRequestEcho(requestBytes, respBytes)
+	// reject the call if the service was unregistered since it was looked up,
+	// e.g. while an interceptor was running. Checking it after addRequest means
+	// an UnregisterServiceAndCancel not seen here cancels the call instead.
+	if current, found := srv.registry.get(service.GetServiceId()); !found || current != service {
+		srv.canceller.requestFinished(requestId)
+		return nil, NewError(ErrorCodeUnknownService, "no service with id %d", service.GetServiceId())
 	}
 
-	// unknown func (or nop, for which we also do nothing)
-	return nil
-}
-
-func (srv Server) callFunctionOnService(ctx context.Context, service ServerService, requestId, functionId int64, requestBytes []byte, respBytes []byte) []byte {
-	// set up cancellation
-	ctx = srv.canceller.addRequest(ctx, requestId)
-
-	// call the function
-	respBytes = service.CallFunction(ctx, functionId, requestBytes, respBytes)
+	// call the function once the executor has a free slot for it
+	err = srv.executor.acquire(ctx, service.GetServiceId())
+	if err == nil {
+		respBytes, err = srv.invokeService(ctx, service, functionId, requestBytes, respBytes)
+		srv.executor.release(service.GetServiceId())
+	}
 
 	// finish cancellation
 	cancelled := srv.canceller.requestFinished(requestId)
 
 	// done
 	if cancelled {
-		return nil
-	} else {
-		return respBytes
+		return nil, NewError(ErrorCodeCancelled, "request %d was cancelled", requestId)
+	}
+	if err != nil {
+		return nil, err
 	}
+	if respBytes == nil {
+		return nil, NewError(ErrorCodeHandlerError, "function %d of service %d failed", functionId, service.GetServiceId())
+	}
+	return respBytes, nil
 }
 
-func (srv Server) handleService(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte) []byte {
+func (srv Server) handleService(ctx context.Context, requestId, serviceId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
 	// if service id is 0, this request is server-related and we need to handle it here
 	if serviceId == 0 {
-		return srv.callFunctionOnServer(functionId, requestBytes, respBytes)
+		return srv.callFunctionOnServer(ctx, requestId, functionId, requestBytes, respBytes)
 	}
 
 	// find service
-	for _, service := range srv.services {
-		if service.GetServiceId() == serviceId {
-			return srv.callFunctionOnService(ctx, service, requestId, functionId, requestBytes, respBytes)
-		}
+	service, found := srv.registry.get(serviceId)
+	if !found {
+		return nil, NewError(ErrorCodeUnknownService, "no service with id %d", serviceId)
 	}
 
-	// not found
-	return nil
+	// call the function
+	return srv.callFunctionWithInterceptors(ctx, service, requestId, functionId, requestBytes, respBytes)
 }
 
 // Process a request represented by the given bytes. On success, the response is
-// appended to respBytes and is returned.
+// appended to respBytes and is returned. On failure, an error response
+// describing the reason is appended instead.
+//
+// The request ids of the requests processed by this function share a single
+// namespace: a request can be cancelled by any caller knowing its id. Use
+// NewSession to isolate the requests of different peers.
+//
+// Neither requestBytes nor respBytes is kept by the server after the function
+// returns, so both can be buffers taken from the buffer pool (see GetBuffer),
+// as long as the services do not keep slices of them either.
+//
+// The request starts with the request id, the service id and the function id.
+// A negative service id means the header carries a timeout: the actual service
+// id is -serviceId-1, and the function id is followed by the timeout in
+// milliseconds. If the function does not finish in time, its context is
+// cancelled and a timed out error is returned.
 func (srv Server) ProcessRequest(ctx context.Context, requestBytes []byte, respBytes []byte) []byte {
 	// parse headers
-	requestBytes, requestId := DeserializeInteger(requestBytes)
-	requestBytes, serviceId := DeserializeInteger(requestBytes)
-	requestBytes, functionId := DeserializeInteger(requestBytes)
+	deserializeHeaderInteger := DeserializeInteger
+	if srv.strictHeaders {
+		deserializeHeaderInteger = DeserializeIntegerStrict
+	}
+	requestSize := len(requestBytes)
+	requestBytes, requestId := deserializeHeaderInteger(requestBytes)
+	requestBytes, serviceId := deserializeHeaderInteger(requestBytes)
+	requestBytes, functionId := deserializeHeaderInteger(requestBytes)
 	if requestBytes == nil {
 		return nil
 	}
 
+	// parse timeout if present
+	if serviceId < 0 {
+		serviceId = -serviceId - 1
+		var timeout_ms int64
+		requestBytes, timeout_ms = deserializeHeaderInteger(requestBytes)
+		if requestBytes == nil {
+			return nil
+		}
+		if timeout_ms > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, millisecondsToDuration(timeout_ms))
+			defer cancel()
+		}
+	}
+
 	// prepare result buffer
 	originalResp := respBytes
 	if requestId > 0 {
-		// write sequence id and integer 1 (=success)
+		// write sequence id and success status
 		respBytes = SerializeInteger(respBytes, requestId)
-		respBytes = SerializeInteger(respBytes, 1)
+		respBytes = SerializeInteger(respBytes, StatusSuccess)
 	} else {
 		// negative request id: expecting no response
 		respBytes = nil
 	}
 
-	// handle service
-	respBytes = srv.handleService(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+	// handle service if the request is not too large, the result is dropped if
+	// the deadline passed meanwhile
+	var err error
+	if srv.maxRequestSize > 0 && requestSize > srv.maxRequestSize {
+		err = NewError(ErrorCodeRequestTooLarge, "request size %d exceeds the limit %d", requestSize, srv.maxRequestSize)
+	} else {
+		respBytes, err = srv.handleService(ctx, requestId, serviceId, functionId, requestBytes, respBytes)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = NewError(ErrorCodeTimedOut, "deadline exceeded")
+	}
 
 	// if request id <= 0, always return nil
 	if requestId <= 0 {
 		return nil
 	}
 
-	// if request failed but client expects a response, return a failed result instead of nil
-	if respBytes == nil {
+	// if request failed but client expects a response, return an error instead of the result
+	if err != nil {
 		respBytes = SerializeInteger(originalResp, requestId)
-		respBytes = SerializeInteger(respBytes, 0)
+		respBytes = SerializeInteger(respBytes, StatusError)
+		respBytes = SerializeError(respBytes, toError(err))
 	}
 
 	// done
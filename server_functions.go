@@ -0,0 +1,150 @@
+package simplerpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Ids of the functions provided by the server itself on service id 0
+const (
+	ServerFunctionGetServices     int64 = 0
+	ServerFunctionCancel          int64 = 1
+	ServerFunctionEcho            int64 = 2
+	ServerFunctionPing            int64 = 3
+	ServerFunctionHealth          int64 = 4
+	ServerFunctionDescribeService int64 = 5
+)
+
+// Optional interface a service can implement to report its readiness to the
+// health check function of the server. Services not implementing it are
+// reported as ready.
+type HealthChecker interface {
+	// Return nil if the service is ready to serve requests, or an error
+	// describing why it is not
+	CheckHealth(ctx context.Context) error
+}
+
+func (srv Server) handleServerRequestGetServices(respBytes []byte) []byte {
+	// write id and revision of each service
+	return SerializeList(respBytes, srv.registry.list(), func(buf []byte, service ServerService) []byte {
+		buf = SerializeInteger(buf, service.GetServiceId())
+		return SerializeString(buf, service.GetRevision())
+	})
+}
+
+func (srv Server) handleServerRequestCancel(requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// read request id to cancel
+	requestBytes, requestIdToCancel := DeserializeInteger(requestBytes)
+	if requestBytes == nil {
+		return nil, NewError(ErrorCodeMalformedRequest, "invalid request id to cancel")
+	}
+
+	// cancel it and write the result
+	result := srv.canceller.cancelRequest(requestIdToCancel)
+	return SerializeInteger(respBytes, result), nil
+}
+
+func (srv Server) handleServerRequestEcho(ctx context.Context, requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// read wait time
+	requestBytes, wait_ms := DeserializeInteger(requestBytes)
+	if requestBytes == nil {
+		return nil, NewError(ErrorCodeMalformedRequest, "invalid wait time")
+	}
+
+	// wait that much time, unless the context is done meanwhile
+	if wait_ms > 0 {
+		timer := time.NewTimer(millisecondsToDuration(wait_ms))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, NewError(ErrorCodeCancelled, "echo was cancelled")
+		}
+	}
+
+	// copy request bytes
+	return append(respBytes, requestBytes...), nil
+}
+
+func (srv Server) handleServerRequestPing(respBytes []byte) []byte {
+	// write server time as unix milliseconds and uptime in milliseconds
+	now := time.Now()
+	respBytes = SerializeInteger(respBytes, now.UnixMilli())
+	respBytes = SerializeInteger(respBytes, now.Sub(srv.startTime).Milliseconds())
+	return respBytes
+}
+
+// Run the health check of a service. A panicking check is recovered like a
+// panicking service function, and the service is reported as not ready.
+func (srv Server) checkServiceHealth(ctx context.Context, service ServerService) (err error) {
+	checker, ok := service.(HealthChecker)
+	if !ok {
+		return nil
+	}
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		srv.reportPanic("health check panicked", service.GetServiceId(), ServerFunctionHealth, value)
+		err = errors.New("health check panicked")
+	}()
+	return checker.CheckHealth(ctx)
+}
+
+func (srv Server) handleServerRequestHealth(ctx context.Context, respBytes []byte) []byte {
+	// write each service: id, 1 if ready or 0 if not, and the reason if not ready
+	return SerializeList(respBytes, srv.registry.list(), func(buf []byte, service ServerService) []byte {
+		err := srv.checkServiceHealth(ctx, service)
+		buf = SerializeInteger(buf, service.GetServiceId())
+		if err != nil {
+			buf = SerializeInteger(buf, 0)
+			return SerializeString(buf, err.Error())
+		}
+		buf = SerializeInteger(buf, 1)
+		return SerializeString(buf, "")
+	})
+}
+
+func (srv Server) callFunctionOnServer(ctx context.Context, requestId, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// disabled func
+	if srv.disabledServerFunctions[functionId] {
+		return nil, NewError(ErrorCodeUnknownFunction, "server function %d is disabled", functionId)
+	}
+
+	// cancel request, this is the only one that cannot be cancelled itself
+	if functionId == ServerFunctionCancel {
+		return srv.handleServerRequestCancel(requestBytes, respBytes)
+	}
+
+	// set up cancellation, reject the request if it was cancelled before it arrived
+	ctx, ok := srv.canceller.addRequest(ctx, requestId, 0)
+	if !ok {
+		return nil, NewError(ErrorCodeCancelled, "request %d was cancelled", requestId)
+	}
+
+	// call the function
+	var err error
+	switch functionId {
+	case ServerFunctionGetServices:
+		respBytes = srv.handleServerRequestGetServices(respBytes)
+	case ServerFunctionEcho:
+		respBytes, err = srv.handleServerRequestEcho(ctx, requestBytes, respBytes)
+	case ServerFunctionPing:
+		respBytes = srv.handleServerRequestPing(respBytes)
+	case ServerFunctionHealth:
+		respBytes = srv.handleServerRequestHealth(ctx, respBytes)
+	case ServerFunctionDescribeService:
+		respBytes, err = srv.handleServerRequestDescribeService(requestBytes, respBytes)
+	default:
+		// unknown func (or nop, for which we also do nothing)
+		respBytes, err = nil, NewError(ErrorCodeUnknownFunction, "no server function with id %d", functionId)
+	}
+
+	// finish cancellation
+	if srv.canceller.requestFinished(requestId) {
+		return nil, NewError(ErrorCodeCancelled, "request %d was cancelled", requestId)
+	}
+	return respBytes, err
+}
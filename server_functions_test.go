@@ -0,0 +1,196 @@
+package simplerpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerEchoCancel(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+
+	// start a long echo
+	done := make(chan []byte)
+	go func() {
+		req := []byte{
+			1,          // request id
+			0,          // service id
+			2,          // function id: echo
+			0x27, 0x10, // wait time=10s
+		}
+		done <- server.ProcessRequest(context.Background(), req, nil)
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// cancel it
+	t0 := time.Now()
+	req := []byte{
+		2, // request id
+		0, // service id
+		1, // function id: cancel
+		1, // request id to cancel
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		2, // request id
+		1, // success
+		1, // found
+	}, resp)
+
+	// the echo returns right away
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), <-done)
+	assert.Less(t, time.Since(t0), time.Millisecond*100)
+}
+
+func TestServerEchoContextDone(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+
+	// the echo aborts when the context of the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+	req := []byte{
+		1,          // request id
+		0,          // service id
+		2,          // function id: echo
+		0x27, 0x10, // wait time=10s
+	}
+	t0 := time.Now()
+	resp := server.ProcessRequest(ctx, req, nil)
+	assert.Less(t, time.Since(t0), time.Millisecond*200)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "echo was cancelled")), resp)
+}
+
+func TestServerEchoLongWait(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+
+	// a wait time too large for a duration waits until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	req := SerializeInteger([]byte{
+		1, // request id
+		0, // service id
+		2, // function id: echo
+	}, 1<<58) // wait time, overflowing to 0 in nanoseconds
+	t0 := time.Now()
+	resp := server.ProcessRequest(ctx, req, nil)
+	assert.GreaterOrEqual(t, time.Since(t0), time.Millisecond*50)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeTimedOut, "deadline exceeded")), resp)
+}
+
+func TestServerPing(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+	time.Sleep(time.Millisecond * 20)
+
+	// ping
+	req := []byte{
+		1, // request id
+		0, // service id
+		3, // function id: ping
+	}
+	t0 := time.Now()
+	resp := server.ProcessRequest(context.Background(), req, nil)
+
+	// check the response
+	resp, requestId := DeserializeInteger(resp)
+	resp, status := DeserializeInteger(resp)
+	resp, serverTime := DeserializeInteger(resp)
+	resp, uptime := DeserializeInteger(resp)
+	assert.Equal(t, []byte{}, resp)
+	assert.EqualValues(t, 1, requestId)
+	assert.EqualValues(t, StatusSuccess, status)
+	assert.InDelta(t, t0.UnixMilli(), serverTime, 1000)
+	assert.GreaterOrEqual(t, uptime, int64(20))
+	assert.Less(t, uptime, int64(1000))
+}
+
+type healthTestService struct {
+	testService
+	err    error
+	panics bool
+}
+
+func (srv *healthTestService) CheckHealth(ctx context.Context) error {
+	if srv.panics {
+		panic("health check failed")
+	}
+	return srv.err
+}
+
+func TestServerHealth(t *testing.T) {
+	// create server with a service without health check, a healthy one and an unhealthy one
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+		&healthTestService{
+			testService: testService{id: 2},
+		},
+		&healthTestService{
+			testService: testService{id: 3},
+			err:         errors.New("db"),
+		},
+	})
+
+	// check health
+	req := []byte{
+		1, // request id
+		0, // service id
+		4, // function id: health
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		1,       // request id
+		1,       // success
+		3,       // 3 services
+		1, 1, 0, // first service: id, ready, no message
+		2, 1, 0, // second service: id, ready, no message
+		3, 0, 2, 'd', 'b', // third service: id, not ready, message
+	}, resp)
+}
+
+func TestServerHealthPanic(t *testing.T) {
+	// create server with a service whose health check panics
+	var panicked []int64
+	server, _ := NewServerWithOptions([]ServerService{
+		&healthTestService{
+			testService: testService{id: 2},
+			panics:      true,
+		},
+	}, WithPanicHandler(func(serviceId, functionId int64, value any, stack []byte) {
+		panicked = append(panicked, serviceId, functionId)
+	}))
+
+	// the service is reported as not ready
+	req := []byte{
+		1, // request id
+		0, // service id
+		4, // function id: health
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeString([]byte{
+		1,    // request id
+		1,    // success
+		1,    // 1 service
+		2, 0, // id, not ready
+	}, "health check panicked"), resp)
+	assert.Equal(t, []int64{2, ServerFunctionHealth}, panicked)
+}
@@ -2,6 +2,9 @@ package simplerpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -19,6 +22,7 @@ type testService struct {
 const id_testfunc_append_string = 1
 const id_testfunc_add_nums = 2
 const id_testfunc_wait_a_little = 3
+const id_testfunc_panic = 5
 
 func (srv *testService) GetServiceId() int64 {
 	return srv.id
@@ -48,6 +52,11 @@ func (srv *testService) CallFunction(ctx context.Context, functionId int64, requ
 		return respBytes
 	}
 
+	// panic
+	if functionId == id_testfunc_panic {
+		panic("test panic")
+	}
+
 	// no such func
 	return nil
 }
@@ -366,10 +375,10 @@ func TestCancel(t *testing.T) {
 	resp = <-done
 
 	// check response
-	assert.Equal(t, []byte{
+	assert.Equal(t, SerializeError([]byte{
 		1, // request id
-		0, // invalid value
-	}, resp)
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), resp)
 }
 
 func TestInvalidRequest(t *testing.T) {
@@ -394,17 +403,17 @@ func TestInvalidId(t *testing.T) {
 		},
 	})
 
-	// request function 4 on service 0 (the server service)
+	// request function 100 on service 0 (the server service)
 	req := []byte{
-		1, // request id
-		0, // service id
-		4, // function id
+		1,         // request id
+		0,         // service id
+		0x20, 100, // function id
 	}
 	resp := server.ProcessRequest(context.Background(), req, nil)
-	assert.Equal(t, []byte{
+	assert.Equal(t, SerializeError([]byte{
 		1, // request id
-		0, // failed
-	}, resp)
+		2, // error
+	}, NewError(ErrorCodeUnknownFunction, "no server function with id 100")), resp)
 
 	// request function 4 on service 1 (test service, this tests the test actually)
 	req = []byte{
@@ -413,10 +422,10 @@ func TestInvalidId(t *testing.T) {
 		4, // function id
 	}
 	resp = server.ProcessRequest(context.Background(), req, nil)
-	assert.Equal(t, []byte{
+	assert.Equal(t, SerializeError([]byte{
 		1, // request id
-		0, // failed
-	}, resp)
+		2, // error
+	}, NewError(ErrorCodeHandlerError, "function 4 of service 1 failed")), resp)
 
 	// request any function on service 2 (no such service)
 	req = []byte{
@@ -425,8 +434,264 @@ func TestInvalidId(t *testing.T) {
 		1, // function id
 	}
 	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeUnknownService, "no service with id 2")), resp)
+}
+
+func TestCallFunctionWithError(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&errorTestService{},
+	})
+
+	// typed error is sent as is
+	req := []byte{
+		1,         // request id
+		1,         // service id
+		0x20, 100, // function id=100
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeApplication+100, "custom error")), resp)
+
+	// other errors are sent as handler errors
+	req = []byte{
+		2, // request id
+		1, // service id
+		1, // function id
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeHandlerError, "plain error")), resp)
+
+	// success
+	req = []byte{
+		3, // request id
+		1, // service id
+		0, // function id
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
 	assert.Equal(t, []byte{
+		3, // request id
+		1, // success
+		7, // result
+	}, resp)
+}
+
+func TestMalformedServerRequest(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+
+	// echo without wait time
+	req := []byte{
+		1, // request id
+		0, // service id
+		2, // function id: echo
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeMalformedRequest, "invalid wait time")), resp)
+}
+
+type errorTestService struct{}
+
+func (srv *errorTestService) GetServiceId() int64 {
+	return 1
+}
+func (srv *errorTestService) GetRevision() string {
+	return ""
+}
+func (srv *errorTestService) CallFunction(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) []byte {
+	panic("CallFunctionWithError must be called instead")
+}
+func (srv *errorTestService) CallFunctionWithError(ctx context.Context, functionId int64, requestBytes []byte, respBytes []byte) ([]byte, error) {
+	// function 0 succeeds, function 1 fails with a plain error, others with a typed error
+	if functionId == 0 {
+		return SerializeInteger(respBytes, 7), nil
+	}
+	if functionId == 1 {
+		return nil, errors.New("plain error")
+	}
+	return nil, NewError(ErrorCodeApplication+ErrorCode(functionId), "custom error")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+
+	// call the panicking function
+	req := []byte{
+		1,                 // request id
+		1,                 // service id
+		id_testfunc_panic, // function id
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodePanic, "")), resp)
+
+	// the request must not be left in the canceller
+	assert.Empty(t, server.canceller.cancels)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+
+	// echo with 100ms wait and 50ms timeout
+	req := []byte{
+		1,        // request id
+		0x80,     // service id=0 with timeout
+		2,        // function id: echo
+		0x20, 50, // timeout=50ms
+		0x20, 100, // wait time=100ms
+	}
+	resp := server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
 		1, // request id
-		0, // failed
+		2, // error
+	}, NewError(ErrorCodeTimedOut, "deadline exceeded")), resp)
+
+	// the timeout applies to the service
+	req = []byte{
+		2,                         // request id
+		0x81,                      // service id=1 with timeout
+		id_testfunc_wait_a_little, // function id
+		0x20, 50,                  // timeout=50ms
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeTimedOut, "deadline exceeded")), resp)
+
+	// enough time
+	req = []byte{
+		3,                         // request id
+		0x81,                      // service id=1 with timeout
+		id_testfunc_wait_a_little, // function id
+		0x23, 0xe8,                // timeout=1000ms
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		3, // request id
+		1, // success
+	}, resp)
+
+	// zero timeout means no deadline
+	req = []byte{
+		4,                    // request id
+		0x81,                 // service id=1 with timeout
+		id_testfunc_add_nums, // function id
+		0,                    // timeout=none
+		1, 2,                 // nums
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		4, // request id
+		1, // success
+		3, // result
 	}, resp)
+
+	// timeout too large for a duration means no deadline
+	req = SerializeInteger([]byte{
+		6,                    // request id
+		0x81,                 // service id=1 with timeout
+		id_testfunc_add_nums, // function id
+	}, math.MaxInt64) // timeout
+	req = append(req, 1, 2) // nums
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{
+		6, // request id
+		1, // success
+		3, // result
+	}, resp)
+
+	// missing timeout
+	req = []byte{
+		5,                    // request id
+		0x81,                 // service id=1 with timeout
+		id_testfunc_add_nums, // function id
+	}
+	resp = server.ProcessRequest(context.Background(), req, nil)
+	assert.Nil(t, resp)
+}
+
+func BenchmarkProcessRequestServiceCount(b *testing.B) {
+	for _, count := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("services=%d", count), func(b *testing.B) {
+			// create server with the given number of services
+			services := make([]ServerService, count)
+			for i := range services {
+				services[i] = &testService{
+					id: int64(i + 1),
+				}
+			}
+			server, _ := NewServer(services)
+
+			// call the last service
+			req := SerializeInteger([]byte{1}, int64(count))
+			req = append(req, id_testfunc_add_nums, 2, 3)
+			resp := make([]byte, 0, 16)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				server.ProcessRequest(context.Background(), req, resp)
+			}
+		})
+	}
+}
+
+func FuzzProcessRequest(f *testing.F) {
+	f.Add([]byte{1, 0, 0})
+	f.Add([]byte{1, 0, 2, 0, 7})
+	f.Add([]byte{1, 0, 5, 1})
+	f.Add([]byte{1, 1, 0})
+	f.Add([]byte{1, 1, 1})
+	f.Add([]byte{2, 0x81, 2, 5, 0, 9})
+	f.Add([]byte{0x80, 0, 1, 1})
+	server, _ := NewServer([]ServerService{
+		&errorTestService{},
+	})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// limit the time of echo requests
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+		resp := server.ProcessRequest(ctx, data, nil)
+		if resp == nil {
+			return
+		}
+
+		// a response must echo the request id and carry a valid status
+		_, requestId := DeserializeInteger(data)
+		resp, respId := DeserializeInteger(resp)
+		assert.Equal(t, requestId, respId)
+		resp, status := DeserializeInteger(resp)
+		switch status {
+		case StatusSuccess:
+			assert.NotNil(t, resp)
+		case StatusError:
+			resp, err := DeserializeError(resp)
+			assert.Equal(t, []byte{}, resp)
+			assert.NotNil(t, err)
+		default:
+			assert.Fail(t, "invalid status", "status=%d", status)
+		}
+	})
 }
@@ -0,0 +1,62 @@
+package simplerpc
+
+import (
+	"context"
+	"sync"
+)
+
+type cancellerSet struct {
+	mu  sync.Mutex
+	set map[*canceller]struct{}
+}
+
+func (s *cancellerSet) add(c *canceller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set[c] = struct{}{}
+}
+
+func (s *cancellerSet) remove(c *canceller) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.set, c)
+}
+
+func (s *cancellerSet) cancelService(serviceId int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.set {
+		c.cancelService(serviceId)
+	}
+}
+
+// Session type scoping the request ids of a peer. The requests processed by a
+// session can only be cancelled by cancel requests processed by the same
+// session, so different peers can use the same request ids without affecting
+// each other.
+type Session struct {
+	srv Server
+}
+
+// Create a new session on the server. The session must be closed when the peer
+// is gone.
+func (srv Server) NewSession() *Session {
+	// the session is a copy of the server with its own canceller
+	srv.canceller = newCanceller(srv.cancelWindow)
+	srv.cancellers.add(srv.canceller)
+	return &Session{
+		srv: srv,
+	}
+}
+
+// Process a request like Server.ProcessRequest, in the scope of the session
+func (s *Session) ProcessRequest(ctx context.Context, requestBytes []byte, respBytes []byte) []byte {
+	return s.srv.ProcessRequest(ctx, requestBytes, respBytes)
+}
+
+// Close the session, cancelling all of its requests still running. Requests
+// processed after closing fail with the ErrorCodeCancelled code.
+func (s *Session) Close() {
+	s.srv.cancellers.remove(s.srv.canceller)
+	s.srv.canceller.close()
+}
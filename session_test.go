@@ -0,0 +1,142 @@
+package simplerpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startSlowCall(processRequest func(context.Context, []byte, []byte) []byte, requestId byte) chan []byte {
+	done := make(chan []byte)
+	go func() {
+		req := []byte{
+			requestId,                 // request id
+			1,                         // service id
+			id_testfunc_wait_a_little, // function id
+		}
+		done <- processRequest(context.Background(), req, nil)
+	}()
+	return done
+}
+
+func TestSessionsIsolateRequestIds(t *testing.T) {
+	// create server with 2 sessions
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	session1 := server.NewSession()
+	defer session1.Close()
+	session2 := server.NewSession()
+	defer session2.Close()
+
+	// start a slow call with the same request id on both
+	done1 := startSlowCall(session1.ProcessRequest, 1)
+	done2 := startSlowCall(session2.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+
+	// cancel it in the first session
+	req := []byte{
+		0, // request id
+		0, // service id
+		1, // function id: cancel
+		1, // request id to cancel
+	}
+	assert.Nil(t, session1.ProcessRequest(context.Background(), req, nil))
+
+	// only the call of the first session is cancelled
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), <-done1)
+	assert.Equal(t, []byte{1, 1}, <-done2)
+}
+
+func TestSessionCannotCancelServerRequests(t *testing.T) {
+	// create server with a session
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	session := server.NewSession()
+	defer session.Close()
+
+	// start a slow call on the server
+	done := startSlowCall(server.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+
+	// cancelling it from the session does nothing
+	req := []byte{
+		0, // request id
+		0, // service id
+		1, // function id: cancel
+		1, // request id to cancel
+	}
+	session.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, []byte{1, 1}, <-done)
+}
+
+func TestSessionClose(t *testing.T) {
+	// create server with a session
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	session := server.NewSession()
+
+	// start 2 slow calls and close the session
+	done1 := startSlowCall(session.ProcessRequest, 1)
+	done2 := startSlowCall(session.ProcessRequest, 2)
+	time.Sleep(time.Millisecond * 50)
+	session.Close()
+
+	// both are cancelled
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), <-done1)
+	assert.Equal(t, SerializeError([]byte{
+		2, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 2 was cancelled")), <-done2)
+
+	// requests after closing fail
+	req := []byte{
+		3,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		2, 3,                 // nums
+	}
+	resp := session.ProcessRequest(context.Background(), req, nil)
+	assert.Equal(t, SerializeError([]byte{
+		3, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 3 was cancelled")), resp)
+}
+
+func TestUnregisterServiceAndCancelInSessions(t *testing.T) {
+	// create server with a session
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	session := server.NewSession()
+	defer session.Close()
+
+	// start a slow call in the session, then unregister the service
+	done := startSlowCall(session.ProcessRequest, 1)
+	time.Sleep(time.Millisecond * 50)
+	assert.Nil(t, server.UnregisterServiceAndCancel(1))
+
+	// the call is cancelled
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), <-done)
+}
@@ -0,0 +1,218 @@
+package simplerpc
+
+import (
+	"bufio"
+	"io"
+)
+
+// Encoder writing values to a stream in the same format as the Serialize
+// functions
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// Create a new encoder writing to w. Each value is written with a separate
+// call to w, wrap w in a bufio.Writer if that is expensive.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:   w,
+		buf: make([]byte, 0, 9),
+	}
+}
+
+func (e *Encoder) writeBuf() error {
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+// Write an integer
+func (e *Encoder) WriteInteger(v int64) error {
+	e.buf = SerializeInteger(e.buf, v)
+	return e.writeBuf()
+}
+
+// Write an unsigned integer
+func (e *Encoder) WriteUint64(v uint64) error {
+	e.buf = SerializeUint64(e.buf, v)
+	return e.writeBuf()
+}
+
+// Write a byte slice
+func (e *Encoder) WriteBlob(data []byte) error {
+	err := e.WriteInteger(int64(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Write a string
+func (e *Encoder) WriteString(v string) error {
+	err := e.WriteInteger(int64(len(v)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, v)
+	return err
+}
+
+// Write a byte slice of the given size, copying the payload from r without
+// holding it in memory. Return io.ErrUnexpectedEOF if r ends before size bytes.
+func (e *Encoder) WriteBlobFrom(r io.Reader, size int64) error {
+	err := e.WriteInteger(size)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(e.w, r, size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Reader counting the bytes read from the underlying stream
+type countingReader struct {
+	r      io.Reader
+	br     io.ByteReader
+	offset int64
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.br.ReadByte()
+	if err == nil {
+		cr.offset++
+	}
+	return b, err
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.offset += int64(n)
+	return n, err
+}
+
+// Decoder reading values from a stream in the same format as the Deserialize
+// functions. Format errors are returned as *DecodeError with the offset of the
+// value in the stream. If the stream ends before the first byte of a value,
+// io.EOF is returned, if it ends inside a value, io.ErrUnexpectedEOF is.
+type Decoder struct {
+	cr   countingReader
+	blob *blobReader
+}
+
+// Create a new decoder reading from r. If r does not implement io.ByteReader,
+// it is wrapped in a bufio.Reader, which may read ahead more bytes than the
+// decoded values.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		bufr := bufio.NewReader(r)
+		r, br = bufr, bufr
+	}
+	return &Decoder{
+		cr: countingReader{
+			r:  r,
+			br: br,
+		},
+	}
+}
+
+// Return the offset of the next byte to read in the stream
+func (d *Decoder) Offset() int64 {
+	return d.cr.offset
+}
+
+func (d *Decoder) readInteger() (int64, error) {
+	// skip the rest of the previous blob
+	if d.blob != nil {
+		_, err := io.Copy(io.Discard, d.blob)
+		d.blob = nil
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// read the value
+	offset := d.cr.offset
+	v, err := readInteger(&d.cr)
+	if err == ErrOverflow {
+		err = &DecodeError{
+			Offset: int(offset),
+			Err:    err,
+		}
+	}
+	return v, err
+}
+
+// Read an integer
+func (d *Decoder) ReadInteger() (int64, error) {
+	return d.readInteger()
+}
+
+// Read the length of a byte slice and return a reader streaming its payload.
+// The payload does not have to be read completely: the rest of it is skipped
+// when the next value is read.
+func (d *Decoder) ReadBlobReader() (io.Reader, int64, error) {
+	// read size
+	offset := d.cr.offset
+	size, err := d.readInteger()
+	if err != nil {
+		return nil, 0, err
+	}
+	if size < 0 {
+		return nil, 0, &DecodeError{
+			Offset: int(offset),
+			Err:    ErrNegativeLength,
+		}
+	}
+
+	// create payload reader
+	d.blob = &blobReader{
+		cr:        &d.cr,
+		remaining: size,
+	}
+	return d.blob, size, nil
+}
+
+// Read a byte slice. The memory is allocated as the payload arrives, so a
+// corrupt length cannot make it allocate more than the stream contains.
+func (d *Decoder) ReadBlob() ([]byte, error) {
+	r, _, err := d.ReadBlobReader()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Read a string
+func (d *Decoder) ReadString() (string, error) {
+	data, err := d.ReadBlob()
+	return string(data), err
+}
+
+// Reader of the payload of a blob
+type blobReader struct {
+	cr        *countingReader
+	remaining int64
+}
+
+func (br *blobReader) Read(p []byte) (int, error) {
+	// check end of payload
+	if br.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	// read no more than the rest of the payload
+	if int64(len(p)) > br.remaining {
+		p = p[:br.remaining]
+	}
+	n, err := br.cr.Read(p)
+	br.remaining -= int64(n)
+	if err == io.EOF && br.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,95 @@
+package simplerpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	// write values
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	assert.Nil(t, e.WriteInteger(-1))
+	assert.Nil(t, e.WriteUint64(0x20))
+	assert.Nil(t, e.WriteString("ab"))
+	assert.Nil(t, e.WriteBlob([]byte{7}))
+	assert.Nil(t, e.WriteBlobFrom(strings.NewReader("xyz"), 3))
+
+	// same bytes as the Serialize functions
+	expected := SerializeInteger([]byte{}, -1)
+	expected = SerializeUint64(expected, 0x20)
+	expected = SerializeString(expected, "ab")
+	expected = SerializeBlob(expected, []byte{7})
+	expected = SerializeString(expected, "xyz")
+	assert.Equal(t, expected, buf.Bytes())
+
+	// the reader of the payload ends early
+	assert.Equal(t, io.ErrUnexpectedEOF, e.WriteBlobFrom(strings.NewReader("x"), 3))
+}
+
+func TestDecoder(t *testing.T) {
+	// read values, the decoder works on a reader without ReadByte as well
+	buf := SerializeInteger([]byte{}, -1)
+	buf = SerializeString(buf, "ab")
+	buf = SerializeBlob(buf, []byte{1, 2, 3, 4})
+	buf = SerializeBlob(buf, []byte{5, 6})
+	buf = SerializeInteger(buf, 0x1234)
+	d := NewDecoder(io.MultiReader(bytes.NewReader(buf)))
+
+	v, err := d.ReadInteger()
+	assert.Nil(t, err)
+	assert.EqualValues(t, -1, v)
+	s, err := d.ReadString()
+	assert.Nil(t, err)
+	assert.Equal(t, "ab", s)
+
+	// stream the payload of a blob, the unread part is skipped
+	r, size, err := d.ReadBlobReader()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, size)
+	part := make([]byte, 2)
+	_, err = io.ReadFull(r, part)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 2}, part)
+
+	// read the rest
+	blob, err := d.ReadBlob()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{5, 6}, blob)
+	v, err = d.ReadInteger()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0x1234, v)
+	assert.EqualValues(t, len(buf), d.Offset())
+
+	// clean end of stream
+	_, err = d.ReadInteger()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderErrors(t *testing.T) {
+	// stream ends inside a value
+	_, err := NewDecoder(bytes.NewReader([]byte{0x20})).ReadInteger()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = NewDecoder(bytes.NewReader([]byte{3, 'a'})).ReadString()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// negative length with the offset of the blob
+	d := NewDecoder(bytes.NewReader([]byte{1, 0x80}))
+	_, err = d.ReadInteger()
+	assert.Nil(t, err)
+	_, err = d.ReadBlob()
+	assert.Equal(t, &DecodeError{Offset: 1, Err: ErrNegativeLength}, err)
+
+	// integer not fitting into 63 bits
+	_, err = NewDecoder(bytes.NewReader([]byte{0x7c, 0x80, 0, 0, 0, 0, 0, 0, 0})).ReadInteger()
+	assert.True(t, errors.Is(err, ErrOverflow))
+
+	// huge length is not allocated up front
+	_, err = NewDecoder(bytes.NewReader(SerializeInteger([]byte{}, 1<<60))).ReadBlob()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
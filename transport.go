@@ -0,0 +1,302 @@
+package simplerpc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Get the total number of bytes of a serialized integer from its first byte
+func serializedIntegerSize(b0 byte) int {
+	switch b0 & integer_sermode_mask {
+	case integer_sermode_00:
+		return 1
+	case integer_sermode_01:
+		return 2
+	case integer_sermode_10:
+		return 3
+	default:
+		return int((b0&0x1c)>>2) + 2
+	}
+}
+
+// Read a serialized integer from the given reader
+func readInteger(r io.ByteReader) (int64, error) {
+	// read the first byte to find out the size
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	// read the rest of the bytes
+	var tmpbuf [9]byte
+	tmpbuf[0] = b0
+	size := serializedIntegerSize(b0)
+	for i := 1; i < size; i++ {
+		tmpbuf[i], err = r.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+
+	// deserialize
+	v, _, err := decodeInteger(tmpbuf[:size])
+	return v, err
+}
+
+// Read a frame (a serialized integer length followed by that many bytes) from
+// the given reader
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	return readFrameLimited(r, 0)
+}
+
+// Number of bytes reserved before the payload by the callers of
+// writeReservedFrame, enough for any serialized integer
+const frameHeaderSpace = 9
+
+func readFrameSize(r *bufio.Reader, maxSize int) (int, error) {
+	// read length
+	size, err := readInteger(r)
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("invalid frame length: %d", size)
+	}
+	if maxSize > 0 && size > int64(maxSize) {
+		return 0, fmt.Errorf("frame length %d exceeds the limit %d", size, maxSize)
+	}
+	return int(size), nil
+}
+
+// Largest frame whose buffer is allocated before its payload arrives. The
+// buffer of a larger frame grows as its bytes arrive, so a peer sending a bogus
+// length cannot make the process allocate more memory than it actually sends.
+const maxPreallocatedFrameSize = 1 << 16
+
+func readFramePayload(r *bufio.Reader, frame []byte) error {
+	_, err := io.ReadFull(r, frame)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func readFrameBytes(r *bufio.Reader, size int) ([]byte, error) {
+	// allocate a small frame at once
+	if size <= maxPreallocatedFrameSize {
+		frame := make([]byte, size)
+		err := readFramePayload(r, frame)
+		if err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	// grow a large one as its bytes arrive
+	frame, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err == nil && len(frame) < size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Read a frame like readFrame, but fail if its length exceeds maxSize. Zero
+// maxSize means no limit.
+func readFrameLimited(r *bufio.Reader, maxSize int) ([]byte, error) {
+	size, err := readFrameSize(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return readFrameBytes(r, size)
+}
+
+// Read a frame like readFrameLimited into a buffer taken from the buffer pool
+func readPooledFrame(r *bufio.Reader, maxSize int) (*Buffer, error) {
+	size, err := readFrameSize(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// large frames are not pooled anyway
+	if size > maxPreallocatedFrameSize {
+		frame, err := readFrameBytes(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return &Buffer{
+			B: frame,
+		}, nil
+	}
+
+	// read into a pooled buffer
+	frame := GetBuffer(size)
+	frame.B = frame.B[:size]
+	err = readFramePayload(r, frame.B)
+	if err != nil {
+		PutBuffer(frame)
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Write a frame (a serialized integer length followed by the payload) to the
+// given writer
+func writeFrame(w io.Writer, payload []byte) error {
+	buf := GetBuffer(frameHeaderSpace + len(payload))
+	defer PutBuffer(buf)
+	buf.B = append(buf.B[:frameHeaderSpace], payload...)
+	return writeReservedFrame(w, buf.B)
+}
+
+// Write a frame whose payload follows frameHeaderSpace reserved bytes in buf.
+// The length is written to the end of the reserved bytes, so the frame is
+// written without copying the payload.
+func writeReservedFrame(w io.Writer, buf []byte) error {
+	var tmpbuf [frameHeaderSpace]byte
+	header := SerializeInteger(tmpbuf[:0], int64(len(buf)-frameHeaderSpace))
+	st := frameHeaderSpace - len(header)
+	copy(buf[st:], header)
+	_, err := w.Write(buf[st:])
+	return err
+}
+
+// Accept connections on the given listener and serve requests on them until
+// the context is cancelled or the listener fails. Each connection carries
+// length-prefixed frames, each frame is a request passed to ProcessRequest.
+// Requests are processed concurrently and the responses are written back in
+// the order they complete. Each connection has its own session, so request ids
+// and cancellations of different connections do not interfere, and the running
+// requests of a connection are cancelled when it is closed. When the context
+// is cancelled, the server shuts down gracefully: the listener is closed and no
+// more frames are read, but the requests already read are not cancelled, they
+// finish and their responses are written before the connections are closed.
+// ServeTCP returns nil once every connection is closed, so the shutdown takes
+// as long as the slowest of the running requests.
+func (srv Server) ServeTCP(ctx context.Context, listener net.Listener) error {
+	// close the listener when the context is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	// accept connections
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// cancelled context means graceful shutdown
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		// serve connection on a separate goroutine
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// Read a request frame. With WithPooledRequestBuffers, it is read into a pooled
+// buffer, which is returned as well so it can be put back.
+func (srv Server) readRequestFrame(r *bufio.Reader) ([]byte, *Buffer, error) {
+	if srv.pooledRequestBuffers {
+		frame, err := readPooledFrame(r, srv.maxRequestSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		return frame.B, frame, nil
+	}
+	frame, err := readFrameLimited(r, srv.maxRequestSize)
+	return frame, nil, err
+}
+
+func (srv Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	// stop reading when the server shuts down, the requests already read are
+	// still processed and answered before the connection is closed
+	stopReading := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stopReading()
+
+	// so the requests are not cancelled by the shutdown, only when the peer is
+	// gone or the connection fails
+	reqCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	// the requests of the connection are processed in their own session
+	session := srv.NewSession()
+	defer session.Close()
+
+	// process frames until reading fails
+	var wg sync.WaitGroup
+	var writeMu sync.Mutex
+	reader := bufio.NewReader(conn)
+	for {
+		frame, frameBuf, err := srv.readRequestFrame(reader)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				srv.log(slog.LevelWarn, "closing connection after read error", "remoteAddr", conn.RemoteAddr().String(), "error", err)
+			}
+			break
+		}
+
+		// process request on a separate goroutine
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// the response is written after the space of the frame header, pooled
+			// buffers are reused once the response is written
+			var resp []byte
+			if frameBuf != nil {
+				respBuf := GetBuffer(frameHeaderSpace + 64)
+				resp = session.ProcessRequest(reqCtx, frame, respBuf.B[:frameHeaderSpace])
+				PutBuffer(frameBuf)
+				if resp != nil {
+					respBuf.B = resp
+				}
+				defer PutBuffer(respBuf)
+			} else {
+				resp = session.ProcessRequest(reqCtx, frame, make([]byte, frameHeaderSpace, frameHeaderSpace+64))
+			}
+			if resp == nil {
+				return
+			}
+
+			// write response
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			err := writeReservedFrame(conn, resp)
+			if err != nil && reqCtx.Err() == nil {
+				srv.log(slog.LevelWarn, "closing connection after write error", "remoteAddr", conn.RemoteAddr().String(), "error", err)
+				cancel()
+				conn.Close()
+			}
+		}()
+	}
+
+	// unless reading stopped because of the shutdown, the peer is gone, so
+	// cancel the in-flight requests, then wait for them
+	if ctx.Err() == nil {
+		cancel()
+	}
+	wg.Wait()
+}
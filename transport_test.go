@@ -0,0 +1,354 @@
+package simplerpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startTestTCPServer(t *testing.T, server Server) (addr string, stop func() error) {
+	// listen on a random port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// serve on a separate goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.ServeTCP(ctx, listener)
+	}()
+
+	// stop cancels the context and waits for the server to return
+	stop = func() error {
+		cancel()
+		return <-done
+	}
+	return listener.Addr().String(), stop
+}
+
+func TestFrameReadWrite(t *testing.T) {
+	// write a short and a long frame
+	var buf bytes.Buffer
+	assert.Nil(t, writeFrame(&buf, []byte{1, 2, 3}))
+	long := make([]byte, 300)
+	assert.Nil(t, writeFrame(&buf, long))
+	assert.Equal(t, []byte{3, 1, 2, 3}, buf.Bytes()[:4])
+	assert.Equal(t, []byte{0x21, 0x2c}, buf.Bytes()[4:6]) // length 300
+
+	// read them back
+	r := bufio.NewReader(&buf)
+	frame, err := readFrame(r)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, frame)
+	frame, err = readFrame(r)
+	assert.Nil(t, err)
+	assert.Equal(t, long, frame)
+
+	// no more frames
+	_, err = readFrame(r)
+	assert.NotNil(t, err)
+
+	// truncated frame
+	r = bufio.NewReader(bytes.NewReader([]byte{5, 1, 2}))
+	_, err = readFrame(r)
+	assert.NotNil(t, err)
+
+	// negative length
+	r = bufio.NewReader(bytes.NewReader([]byte{0x80}))
+	_, err = readFrame(r)
+	assert.NotNil(t, err)
+}
+
+func TestFrameReadHugeLength(t *testing.T) {
+	// a frame declaring 64 GiB but ending early fails without allocating it
+	header := SerializeInteger([]byte{}, 1<<36)
+	r := bufio.NewReader(bytes.NewReader(append(header, 1, 2, 3)))
+	_, err := readFrame(r)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	r = bufio.NewReader(bytes.NewReader(append(header, 1, 2, 3)))
+	_, err = readPooledFrame(r, 0)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// a large frame is read completely
+	long := make([]byte, maxPreallocatedFrameSize*3+5)
+	long[len(long)-1] = 7
+	var buf bytes.Buffer
+	assert.Nil(t, writeFrame(&buf, long))
+	assert.Nil(t, writeFrame(&buf, long))
+	r = bufio.NewReader(&buf)
+	frame, err := readFrame(r)
+	assert.Nil(t, err)
+	assert.Equal(t, long, frame)
+	pooled, err := readPooledFrame(r, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, long, pooled.B)
+}
+
+func TestServeTCP(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+
+	// connect
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// send a slow request, then a fast one
+	assert.Nil(t, writeFrame(conn, []byte{
+		1,                         // request id
+		1,                         // service id
+		id_testfunc_wait_a_little, // function id
+	}))
+	assert.Nil(t, writeFrame(conn, []byte{
+		2,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		3,                    // num 1=3
+		4,                    // num 2=4
+	}))
+
+	// the fast one should complete first
+	frame, err := readFrame(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		2, // request id
+		1, // success
+		7, // result
+	}, frame)
+	frame, err = readFrame(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		1, // request id
+		1, // success
+	}, frame)
+
+	// stop the server
+	assert.Nil(t, stop())
+}
+
+func TestServeTCPShutdownClosesConnections(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{})
+	addr, stop := startTestTCPServer(t, server)
+
+	// connect and make sure the connection is served
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	assert.Nil(t, writeFrame(conn, []byte{1, 0, 0}))
+	_, err = readFrame(reader)
+	assert.Nil(t, err)
+
+	// stop the server, the connection must be closed
+	assert.Nil(t, stop())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = readFrame(reader)
+	assert.NotNil(t, err)
+}
+
+func TestServeTCPDisconnectCancelsRequests(t *testing.T) {
+	// create server
+	service := &blockingService{
+		cancelled: make(chan struct{}),
+	}
+	server, _ := NewServer([]ServerService{service})
+	addr, stop := startTestTCPServer(t, server)
+
+	// start a blocking call, then close the connection
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	assert.Nil(t, writeFrame(conn, []byte{
+		1, // request id
+		1, // service id
+		1, // function id
+	}))
+	time.Sleep(time.Millisecond * 50)
+	conn.Close()
+
+	// the handler's context must be cancelled
+	select {
+	case <-service.cancelled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "request was not cancelled")
+	}
+
+	// stop the server
+	assert.Nil(t, stop())
+}
+
+func TestServeTCPHugeFrameLength(t *testing.T) {
+	// create server without a request size limit
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+
+	// declare a 64 GiB frame, then close the connection
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	_, err = conn.Write(SerializeInteger([]byte{}, 1<<36))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 50)
+	conn.Close()
+
+	// the server still serves other connections
+	conn, err = net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, writeFrame(conn, []byte{
+		1,                    // request id
+		1,                    // service id
+		id_testfunc_add_nums, // function id
+		3,                    // num 1=3
+		4,                    // num 2=4
+	}))
+	frame, err := readFrame(bufio.NewReader(conn))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 1, 7}, frame)
+
+	// stop the server
+	assert.Nil(t, stop())
+}
+
+func TestServeTCPShutdownFinishesRequests(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+
+	// start a slow call
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	assert.Nil(t, writeFrame(conn, []byte{
+		1,                         // request id
+		1,                         // service id
+		id_testfunc_wait_a_little, // function id
+	}))
+	time.Sleep(time.Millisecond * 50)
+
+	// stop the server while the call is running
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- stop()
+	}()
+
+	// the call still succeeds, then the connection is closed
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := readFrame(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		1, // request id
+		1, // success
+	}, frame)
+	_, err = readFrame(reader)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, <-stopped)
+}
+
+func TestServeTCPConnectionsHaveOwnSessions(t *testing.T) {
+	// create server
+	server, _ := NewServer([]ServerService{
+		&testService{
+			id: 1,
+		},
+	})
+	addr, stop := startTestTCPServer(t, server)
+
+	// connect twice
+	conn1, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn1.Close()
+	conn2, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn2.Close()
+
+	// start a slow call with the same request id on both connections
+	slowReq := []byte{
+		1,                         // request id
+		1,                         // service id
+		id_testfunc_wait_a_little, // function id
+	}
+	assert.Nil(t, writeFrame(conn1, slowReq))
+	assert.Nil(t, writeFrame(conn2, slowReq))
+	time.Sleep(time.Millisecond * 50)
+
+	// cancel it on the second connection only
+	assert.Nil(t, writeFrame(conn2, []byte{
+		0, // request id
+		0, // service id
+		1, // function id: cancel
+		1, // request id to cancel
+	}))
+
+	// the call on the first connection succeeds
+	frame, err := readFrame(bufio.NewReader(conn1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 1}, frame)
+	frame, err = readFrame(bufio.NewReader(conn2))
+	assert.Nil(t, err)
+	assert.Equal(t, SerializeError([]byte{
+		1, // request id
+		2, // error
+	}, NewError(ErrorCodeCancelled, "request 1 was cancelled")), frame)
+
+	// stop the server
+	assert.Nil(t, stop())
+}
+
+func BenchmarkServeConnSmallCall(b *testing.B) {
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pooled=%v", pooled), func(b *testing.B) {
+			// serve a connection over a pipe
+			server, _ := NewServerWithOptions([]ServerService{
+				&testService{
+					id: 1,
+				},
+			}, WithPooledRequestBuffers(pooled))
+			clientConn, serverConn := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				server.serveConn(context.Background(), serverConn)
+				close(done)
+			}()
+
+			// add 2 numbers again and again
+			var frame bytes.Buffer
+			writeFrame(&frame, []byte{1, 1, id_testfunc_add_nums, 2, 3})
+			reader := bufio.NewReader(clientConn)
+			resp := make([]byte, 16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				clientConn.Write(frame.Bytes())
+				size, _ := readFrameSize(reader, 0)
+				readFramePayload(reader, resp[:size])
+			}
+
+			// done
+			b.StopTimer()
+			clientConn.Close()
+			<-done
+		})
+	}
+}